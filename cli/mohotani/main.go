@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/docopt/docopt-go"
+	"github.com/tjamet/mohotani/command"
 	"github.com/tjamet/mohotani/dns/lister"
 	"github.com/tjamet/mohotani/dns/lister/docker"
 	"github.com/tjamet/mohotani/dns/provider"
@@ -17,10 +28,20 @@ import (
 	logProvider "github.com/tjamet/mohotani/dns/provider/log_provider"
 	"github.com/tjamet/mohotani/dns/provider/route53"
 	"github.com/tjamet/mohotani/dns/updater"
+	"github.com/tjamet/mohotani/election"
+	"github.com/tjamet/mohotani/healthcheck"
 	"github.com/tjamet/mohotani/ip"
+	ipDocker "github.com/tjamet/mohotani/ip/docker"
+	"github.com/tjamet/mohotani/journal"
 	"github.com/tjamet/mohotani/listener"
 	"github.com/tjamet/mohotani/listener/kubernetes"
 	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/metrics"
+	"github.com/tjamet/mohotani/notify"
+	"github.com/tjamet/mohotani/probe"
+	"github.com/tjamet/mohotani/state"
+	"golang.org/x/time/rate"
+	k8s "k8s.io/client-go/kubernetes"
 )
 
 func stripAlign(in string) string {
@@ -51,34 +72,609 @@ func oneOf(args map[string]interface{}, keys ...string) string {
 	return provided[0]
 }
 
-func newIPListener(args map[string]interface{}, ticker <-chan time.Time, method string, logger logger.Logger) listener.Listener {
+func parseDuration(args map[string]interface{}, key string) time.Duration {
+	duration, err := time.ParseDuration(args[key].(string))
+	if err != nil {
+		log.Fatalf(stripAlign(`Failed to parse %s duration: %s.
+			|
+			|A duration string is a possibly signed sequence of decimal numbers, each with optional fraction and a unit suffix,
+			|such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".`), key, err.Error())
+	}
+	return duration
+}
+
+// newCommand instanciates the command given by option key, run by sh so its arguments can be quoted
+func newCommand(args map[string]interface{}, key string) command.Command {
+	script := args[key].(string)
+	if strings.TrimSpace(script) == "" {
+		log.Fatalf("Missing command in %s", key)
+	}
+	c := command.Shell(script)
+	if names := args["--exec.env"]; names != nil {
+		c.Env = strings.Split(names.(string), ",")
+	}
+	c.Timeout = parseDuration(args, "--exec.timeout")
+	c.JSON = args[key+".json"].(bool)
+	return *c
+}
+
+// newLimiter returns the rate limiter of the calls to the DNS provider, nil when no limit applies
+func newLimiter(args map[string]interface{}, method string) *rate.Limiter {
+	var limit float64
+	if value := args["--update.rate"]; value != nil {
+		l, err := strconv.ParseFloat(value.(string), 64)
+		if err != nil {
+			log.Fatalf("Failed to parse --update.rate: %s", err.Error())
+		}
+		limit = l
+	} else {
+		switch method {
+		case "gandi":
+			limit = gandi.UpdateRate
+		case "route53":
+			limit = route53.UpdateRate
+		}
+	}
+	if limit <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(limit), parseInt(args, "--update.burst"))
+}
+
+// k8sClient is the kubernetes client shared by the election, the state and the listeners of all leadership terms
+var k8sClient struct {
+	once   sync.Once
+	client k8s.Interface
+}
+
+// newKubernetesClient returns the kubernetes client of the process, created on first use
+func newKubernetesClient() k8s.Interface {
+	k8sClient.once.Do(func() {
+		k8sClient.client = kubernetes.NewClient()
+	})
+	return k8sClient.client
+}
+
+// newDockerClient returns a docker client configured from the environment, closed once ctx is done
+func newDockerClient(ctx context.Context) *client.Client {
+	cl, err := client.NewEnvClient()
+	if err != nil {
+		log.Fatalf("Failed to create docker client: %s", err.Error())
+	}
+	go func() {
+		<-ctx.Done()
+		cl.Close()
+	}()
+	return cl
+}
+
+// newState opens the state persisted in --state.file, --state.k8s.configmap or --state.k8s.secret, nil when none is given
+func newState(args map[string]interface{}, logger logger.Logger) *state.Registry {
+	var store state.Store
+	if path := args["--state.file"]; path != nil {
+		store = &state.File{Path: path.(string)}
+	} else if name := args["--state.k8s.configmap"]; name != nil {
+		store = &state.ConfigMap{Client: newKubernetesClient(), Namespace: args["--state.k8s.namespace"].(string), Name: name.(string)}
+	} else if name := args["--state.k8s.secret"]; name != nil {
+		store = &state.ConfigMap{Client: newKubernetesClient(), Namespace: args["--state.k8s.namespace"].(string), Name: name.(string), Secret: true}
+	} else {
+		if args["--update.prune"].(bool) {
+			log.Fatal("--update.prune requires a state, given with --state.file, --state.k8s.configmap or --state.k8s.secret")
+		}
+		return nil
+	}
+	registry, err := state.Open(context.Background(), store)
+	if err != nil {
+		log.Fatalf("Failed to load the state: %s", err.Error())
+	}
+	registry.Timeout = parseDuration(args, "--update.timeout")
+	registry.Logger = logger
+	return registry
+}
+
+// newJournal opens the journal of the changes in --journal.file, nil when none is given
+func newJournal(args map[string]interface{}) *journal.Journal {
+	path := args["--journal.file"]
+	if path == nil {
+		return nil
+	}
+	j, err := journal.Open(path.(string))
+	if err != nil {
+		log.Fatalf("Failed to load the journal: %s", err.Error())
+	}
+	return j
+}
+
+// requireJournal opens the journal of the changes in --journal.file, it fails when none is given
+func requireJournal(args map[string]interface{}) *journal.Journal {
+	j := newJournal(args)
+	if j == nil {
+		log.Fatal("Missing journal, please provide it through --journal.file")
+	}
+	return j
+}
+
+// newLogger instanciates the logger writing the entries of at least --log.level on the standard output, encoded as --log.format
+func newLogger(args map[string]interface{}) logger.Logger {
+	encoder, err := logger.NewEncoder(args["--log.format"].(string))
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, err := logger.ParseLevel(args["--log.level"].(string))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return logger.New(os.Stdout, encoder, level)
+}
+
+// newElector returns the elector of --election.k8s.lease or --election.file, nil when no election is configured
+func newElector(args map[string]interface{}, logger logger.Logger) election.Elector {
+	identity, _ := os.Hostname()
+	if id := args["--election.id"]; id != nil {
+		identity = id.(string)
+	}
+	if identity == "" {
+		log.Fatal("Failed to get the host name, the election identity must be given with --election.id")
+	}
+	if lease := args["--election.k8s.lease"]; lease != nil {
+		return &election.Lease{
+			Client:        newKubernetesClient(),
+			Namespace:     args["--election.k8s.namespace"].(string),
+			Name:          lease.(string),
+			Identity:      identity,
+			LeaseDuration: parseDuration(args, "--election.lease-duration"),
+			RenewDeadline: parseDuration(args, "--election.renew-deadline"),
+			RetryPeriod:   parseDuration(args, "--election.retry-period"),
+			Logger:        logger,
+		}
+	}
+	if path := args["--election.file"]; path != nil {
+		return &election.File{
+			Path:        path.(string),
+			Identity:    identity,
+			RetryPeriod: parseDuration(args, "--election.retry-period"),
+			Logger:      logger,
+		}
+	}
+	return nil
+}
+
+// newRetryBackoff returns the backoff of the retries of failed updates, nil when retries are disabled
+func newRetryBackoff(args map[string]interface{}) *updater.Backoff {
+	backoff := updater.DefaultBackoff
+	backoff.Initial = parseDuration(args, "--retry.delay")
+	backoff.Max = parseDuration(args, "--retry.max-delay")
+	backoff.MaxAttempts = parseInt(args, "--retry.attempts")
+	if backoff.MaxAttempts <= 0 {
+		return nil
+	}
+	return &backoff
+}
+
+// parseHeaders parses http headers with format <Name>: <value>
+func parseHeaders(headers []string) map[string]string {
+	parsed := map[string]string{}
+	for _, header := range headers {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			log.Fatalf("Invalid http header %s, headers must have format <Name>: <value>", header)
+		}
+		parsed[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return parsed
+}
+
+// parseTemplate parses the notification template in the file given by option, nil when the option is not set
+func parseTemplate(args map[string]interface{}, option string) *template.Template {
+	path := args[option]
+	if path == nil {
+		return nil
+	}
+	t, err := notify.ParseFile(path.(string))
+	if err != nil {
+		log.Fatalf("Invalid %s: %s", option, err.Error())
+	}
+	return t
+}
+
+// readSecret returns the value of option, or else the content of the file given by fileOption,
+// and whether any of them is set
+func readSecret(args map[string]interface{}, option, fileOption string) (string, bool) {
+	if value := args[option]; value != nil {
+		return value.(string), true
+	}
+	path := args[fileOption]
+	if path == nil {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(path.(string))
+	if err != nil {
+		log.Fatalf("Failed to read %s %s: %s", fileOption, path.(string), err.Error())
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+// newNotifier instanciates the notifiers of the changes, nil when no notification is configured
+func newNotifier(args map[string]interface{}) notify.Notifier {
+	notifiers := notify.All{}
+	if url := args["--notify.webhook"]; url != nil {
+		notifiers = append(notifiers, &notify.Webhook{
+			URL:      url.(string),
+			Headers:  parseHeaders(args["--notify.webhook.header"].([]string)),
+			Template: parseTemplate(args, "--notify.webhook.template"),
+		})
+	}
+	if url, ok := readSecret(args, "--notify.slack", "--notify.slack.url-file"); ok {
+		notifiers = append(notifiers, &notify.Slack{
+			URL:      url,
+			Template: parseTemplate(args, "--notify.slack.template"),
+		})
+	}
+	if addr := args["--notify.smtp"]; addr != nil {
+		to := args["--notify.smtp.to"]
+		if to == nil {
+			log.Fatal("Missing mail recipients, please provide them through --notify.smtp.to")
+		}
+		smtp := &notify.SMTP{
+			Addr:     addr.(string),
+			TLS:      args["--notify.smtp.tls"].(bool),
+			From:     args["--notify.smtp.from"].(string),
+			To:       strings.Split(to.(string), ","),
+			Template: parseTemplate(args, "--notify.smtp.template"),
+		}
+		if user := args["--notify.smtp.user"]; user != nil {
+			smtp.Username = user.(string)
+		}
+		if password, ok := readSecret(args, "--notify.smtp.password", "--notify.smtp.password-file"); ok {
+			smtp.Password = password
+		}
+		if subject := args["--notify.smtp.subject"]; subject != nil {
+			t, err := notify.Parse("subject", subject.(string))
+			if err != nil {
+				log.Fatalf("Invalid --notify.smtp.subject: %s", err.Error())
+			}
+			smtp.Subject = t
+		}
+		notifiers = append(notifiers, smtp)
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	kinds, err := notify.ParseKinds(args["--notify.events"].(string))
+	if err != nil {
+		log.Fatalf("Invalid --notify.events: %s", err.Error())
+	}
+	return &notify.Filter{Notifier: notifiers, Kinds: kinds}
+}
+
+// newTicker returns the channel of a ticker stopped once ctx is done
+func newTicker(ctx context.Context, interval time.Duration) <-chan time.Time {
+	ticker := time.NewTicker(interval)
+	go func() {
+		<-ctx.Done()
+		ticker.Stop()
+	}()
+	return ticker.C
+}
+
+// newResyncTicker returns the channel triggering resyncs until ctx is done, nil when resyncs are disabled
+func newResyncTicker(ctx context.Context, interval time.Duration) <-chan time.Time {
+	if interval <= 0 {
+		return nil
+	}
+	return newTicker(ctx, interval)
+}
+
+// newPollListener instanciates a listener polling at each tick, each poll being limited to --watch.timeout.
+// Polls are counted in metrics with the name of the listener and the source it polls
+func newPollListener(args map[string]interface{}, name, source string, ticker <-chan time.Time, poll listener.Poll, logger logger.Logger) listener.Listener {
+	return &listener.PollListener{
+		Ticker:  ticker,
+		Logger:  logger,
+		Poll:    poll,
+		Timeout: parseDuration(args, "--watch.timeout"),
+		Name:    name,
+		Source:  source,
+	}
+}
+
+// newIPPollListener instanciates a listener polling IPs at each tick, only publishing stable changes
+// according to --ips.stable.polls and --ips.stable.delay
+func newIPPollListener(args map[string]interface{}, source string, ticker <-chan time.Time, poll listener.Poll, logger logger.Logger) listener.Listener {
+	l := newPollListener(args, "ips", source, ticker, poll, logger).(*listener.PollListener)
+	l.StablePolls = parseInt(args, "--ips.stable.polls")
+	l.StableFor = parseDuration(args, "--ips.stable.delay")
+	return l
+}
+
+// newIPStableListener damps a listener notifying IP changes as they happen. Changes must last --ips.stable.delay,
+// and at least as long as --ips.stable.polls polls would take, before being published
+func newIPStableListener(args map[string]interface{}, source string, l listener.Listener, log logger.Logger) listener.Listener {
+	stableFor := parseDuration(args, "--ips.stable.delay")
+	if polls := parseInt(args, "--ips.stable.polls"); polls > 1 {
+		if d := time.Duration(polls-1) * parseDuration(args, "--watch.delay"); d > stableFor {
+			stableFor = d
+		}
+	}
+	return &listener.StableListener{
+		Listener:  l,
+		Logger:    logger.With(log, logger.Listener("ips"), logger.F("source", source)),
+		StableFor: stableFor,
+	}
+}
+
+// newSettledListener delays the lists of a listener until they did not change for --domains.settle
+func newSettledListener(args map[string]interface{}, l listener.Listener) listener.Listener {
+	return &listener.DebounceListener{
+		Listener: l,
+		Quiet:    parseDuration(args, "--domains.settle"),
+		MaxDelay: parseDuration(args, "--domains.settle.max"),
+	}
+}
+
+// newIPResolver instanciates the resolver of a polled IP resolution method, its clients are closed once ctx is done
+func newIPResolver(ctx context.Context, args map[string]interface{}, method string, logger logger.Logger) ip.Resolver {
 	switch method {
 	case "static":
 		ips := args["--ips.static.values"]
 		if ips == nil {
 			log.Fatal("static ips resolution requires IPs provided on the command line with --ips.static.values option, separated by comas")
 		}
-		return &listener.PollListener{
-			Ticker: ticker,
-			Logger: logger,
-			Poll:   (&ip.Static{IPs: strings.Split(ips.(string), ",")}).Resolve,
-		}
+		return &ip.Static{IPs: strings.Split(ips.(string), ",")}
 	case "ipify":
 		ipify := ip.NewIPify()
 		if url := args["--ips.ipify.url"]; url != nil {
 			ipify.URL = url.(string)
 		}
-		return &listener.PollListener{
-			Ticker: ticker,
-			Logger: logger,
-			Poll:   ipify.Resolve,
+		return ipify
+	case "metadata":
+		cloud := args["--ips.metadata.cloud"].(string)
+		if cloud == "auto" {
+			cloud = ""
+		}
+		metadata, err := ip.NewMetadata(cloud)
+		if err != nil {
+			log.Fatalf("Failed to create metadata IP resolver: %s", err.Error())
+		}
+		if url := args["--ips.metadata.url"]; url != nil {
+			metadata.URL = url.(string)
+		}
+		return metadata
+	case "http":
+		h := ip.NewHTTP(args["--ips.http"].(string))
+		for name, value := range parseHeaders(args["--ips.http.header"].([]string)) {
+			h.Headers[name] = value
+		}
+		if user := args["--ips.http.user"]; user != nil {
+			h.Username = user.(string)
+		}
+		if password := args["--ips.http.password"]; password != nil {
+			h.Password = password.(string)
+		}
+		h.Timeout = parseDuration(args, "--ips.http.timeout")
+		if args["--ips.http.json"] != nil && args["--ips.http.regexp"] != nil {
+			log.Fatal("Only one of --ips.http.json, --ips.http.regexp should be provided")
+		}
+		if path := args["--ips.http.json"]; path != nil {
+			h.Parser = ip.JSONPath(path.(string))
+		}
+		if args["--ips.http.regexp"] != nil {
+			expression, err := regexp.Compile(args["--ips.http.regexp"].(string))
+			if err != nil {
+				log.Fatalf("Failed to parse regular expression %s: %s", args["--ips.http.regexp"].(string), err.Error())
+			}
+			h.Parser = ip.Regexp(expression)
 		}
+		return h
+	case "hostnames":
+		h := &ip.Hostnames{
+			Names:   strings.Split(args["--ips.hostnames"].(string), ","),
+			Timeout: parseDuration(args, "--ips.hostnames.timeout"),
+		}
+		if server := args["--ips.hostnames.server"]; server != nil {
+			h.Server = server.(string)
+		}
+		return h
+	case "exec":
+		return &ip.Exec{Command: newCommand(args, "--ips.exec")}
+	case "swarm":
+		nodes := &ipDocker.SwarmNodes{
+			Client:      newDockerClient(ctx),
+			Logger:      logger,
+			Service:     args["--ips.swarm.service"].(string),
+			AllowBogons: args["--ips.allow-bogons"].(bool),
+		}
+		if label := args["--ips.swarm.label"]; label != nil {
+			nodes.Label = label.(string)
+		}
+		return nodes
 	default:
 		log.Fatalf("Unknown IP listener %s", method)
 	}
 	return nil
 }
 
+// newIPListener instanciates the listener of the IP resolution methods.
+// Several polled methods are combined according to --ips.chain.policy
+func newIPListener(ctx context.Context, args map[string]interface{}, ticker <-chan time.Time, methods []string, logger logger.Logger) listener.Listener {
+	resolvers := []ip.Resolver{}
+	for _, method := range methods {
+		if len(methods) > 1 && strings.HasPrefix(method, "k8s.") {
+			log.Fatalf("The %s IP listener cannot be chained", method)
+		}
+		switch method {
+		case "k8s.service":
+			return newIPStableListener(args, method, kubernetes.NewServiceIPLister(newKubernetesClient(), args["--ips.k8s.namespace"].(string), args["--ips.k8s.service"].(string)), logger)
+		case "k8s.nodes":
+			l, err := kubernetes.NewNodeIPLister(newKubernetesClient(), args["--ips.k8s.namespace"].(string), args["--ips.k8s.nodes"].(string))
+			if err != nil {
+				log.Fatalf("Failed to parse pod selector %s: %s", args["--ips.k8s.nodes"].(string), err.Error())
+			}
+			return newIPStableListener(args, method, l, logger)
+		}
+		r := newIPResolver(ctx, args, method, logger)
+		if nodes, ok := r.(*ipDocker.SwarmNodes); ok && args["--ips.swarm.watch"].(bool) {
+			ticker = nodes.EventTicker(ctx, ticker)
+		}
+		resolvers = append(resolvers, r)
+	}
+	if len(resolvers) > 1 {
+		// the polls of the chain are counted as a whole, the resolutions of its members are counted separately
+		for i, r := range resolvers {
+			resolvers[i] = &ip.Instrumented{Resolver: r, Name: methods[i]}
+		}
+	}
+	if failures := parseInt(args, "--ips.sticky"); failures > 0 {
+		// the last IPs of a single method are already kept by the listener when it fails
+		if len(resolvers) < 2 {
+			log.Fatal("--ips.sticky requires several IP resolution methods combined with --ips.chain")
+		}
+		for i, r := range resolvers {
+			resolvers[i] = &ip.Sticky{Resolver: r, MaxFailures: failures}
+		}
+	}
+	resolver := resolvers[0]
+	if len(resolvers) > 1 {
+		switch args["--ips.chain.policy"].(string) {
+		case "first":
+			resolver = &ip.FirstSuccess{Resolvers: resolvers}
+		case "union":
+			resolver = &ip.Union{Resolvers: resolvers}
+		default:
+			log.Fatalf("Unknown IP chain policy %s, expecting one of first, union", args["--ips.chain.policy"].(string))
+		}
+	}
+	return newIPPollListener(args, strings.Join(methods, ","), ticker, resolver.Resolve, logger)
+}
+
+func newIPFilter(args map[string]interface{}) *ip.Filter {
+	f := &ip.Filter{
+		AllowBogons: args["--ips.allow-bogons"].(bool),
+		AllowEmpty:  args["--ips.allow-empty"].(bool),
+	}
+	for key, networks := range map[string]*[]*net.IPNet{"--ips.allow": &f.Allow, "--ips.deny": &f.Deny} {
+		if value := args[key]; value != nil {
+			n, err := ip.ParseNetworks(strings.Split(value.(string), ",")...)
+			if err != nil {
+				log.Fatalf("Failed to parse %s: %s", key, err.Error())
+			}
+			*networks = n
+		}
+	}
+	return f
+}
+
+func parseInt(args map[string]interface{}, key string) int {
+	value, err := strconv.Atoi(args[key].(string))
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %s", key, err.Error())
+	}
+	return value
+}
+
+// newHealthCheckedListener health checks the IPs of a listener every --healthcheck.interval until ctx is done.
+// The fallback IPs are published as is, they must pass check
+func newHealthCheckedListener(ctx context.Context, args map[string]interface{}, check listener.Check, l listener.Listener, logger logger.Logger) listener.Listener {
+	method := args["--healthcheck"]
+	if method == nil {
+		return l
+	}
+	var checker healthcheck.Checker
+	switch method.(string) {
+	case "tcp":
+		if args["--healthcheck.port"] == nil {
+			log.Fatal("tcp health checks require a port provided on the command line with --healthcheck.port")
+		}
+		checker = &healthcheck.TCP{
+			Port:    parseInt(args, "--healthcheck.port"),
+			Timeout: parseDuration(args, "--healthcheck.timeout"),
+		}
+	case "http", "https":
+		h := &healthcheck.HTTP{
+			Scheme:             method.(string),
+			Path:               args["--healthcheck.path"].(string),
+			ExpectedStatus:     parseInt(args, "--healthcheck.status"),
+			Timeout:            parseDuration(args, "--healthcheck.timeout"),
+			InsecureSkipVerify: args["--healthcheck.insecure"].(bool),
+		}
+		if args["--healthcheck.port"] != nil {
+			h.Port = parseInt(args, "--healthcheck.port")
+		}
+		if host := args["--healthcheck.host"]; host != nil {
+			h.Host = host.(string)
+		}
+		checker = h
+	default:
+		log.Fatalf("Unknown health check %s, expecting one of tcp, http, https", method.(string))
+	}
+	fallback := []string{}
+	if ips := args["--healthcheck.fallback"]; ips != nil {
+		fallback = strings.Split(ips.(string), ",")
+		if err := check(fallback); err != nil {
+			log.Fatalf("Invalid --healthcheck.fallback: %s", err.Error())
+		}
+	}
+	return &healthcheck.Listener{
+		Listener: l,
+		Checker:  checker,
+		Ticker:   newTicker(ctx, parseDuration(args, "--healthcheck.interval")),
+		Rise:     parseInt(args, "--healthcheck.rise"),
+		Fall:     parseInt(args, "--healthcheck.fall"),
+		Fallback: fallback,
+		Logger:   logger,
+	}
+}
+
+// newCheckedIPListener filters and health checks the IPs of an IP listener until ctx is done,
+// rejected IPs are counted as poll errors of source
+func newCheckedIPListener(ctx context.Context, args map[string]interface{}, source string, l listener.Listener, logger logger.Logger) listener.Listener {
+	filter := newIPFilter(args)
+	return newHealthCheckedListener(ctx, args, filter.Check, &listener.FilterListener{
+		Listener: l,
+		Logger:   logger,
+		Check:    filter.Check,
+		Name:     "ips",
+		Source:   source,
+	}, logger)
+}
+
+func newIPv6Prefix(args map[string]interface{}) *ip.IPv6Prefix {
+	prefix := &ip.IPv6Prefix{
+		Length: parseInt(args, "--ips.ipv6-prefix.length"),
+	}
+	switch oneOf(args, "--ips.ipv6-prefix.interface", "--ips.ipv6-prefix.url") {
+	case "--ips.ipv6-prefix.interface":
+		prefix.Interface = args["--ips.ipv6-prefix.interface"].(string)
+	case "--ips.ipv6-prefix.url":
+		prefix.Resolver = ip.NewHTTP(args["--ips.ipv6-prefix.url"].(string))
+	}
+	return prefix
+}
+
+// pollIPv6Prefix returns a poll of the current prefix, as a single CIDR notation
+func pollIPv6Prefix(prefix *ip.IPv6Prefix) listener.Poll {
+	return func(ctx context.Context) ([]string, error) {
+		network, err := prefix.Prefix(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []string{network.String()}, nil
+	}
+}
+
+// hostAddresses returns the function turning the prefixes polled by pollIPv6Prefix into the address of host
+func hostAddresses(host *ip.IPv6Host) func([]string) []string {
+	return func(prefixes []string) []string {
+		addresses := []string{}
+		for _, prefix := range prefixes {
+			if _, network, err := net.ParseCIDR(prefix); err == nil {
+				addresses = append(addresses, host.Address(network))
+			}
+		}
+		return addresses
+	}
+}
+
 func newDNSUpdater(args map[string]interface{}, method string, logger logger.Logger) provider.Updater {
 	switch method {
 	case "log":
@@ -116,37 +712,27 @@ func newDNSUpdater(args map[string]interface{}, method string, logger logger.Log
 	return nil
 }
 
-func newDomainListener(args map[string]interface{}, ticker <-chan time.Time, method string, logger logger.Logger) listener.Listener {
+func newDomainListener(ctx context.Context, args map[string]interface{}, ticker <-chan time.Time, method string, logger logger.Logger) listener.Listener {
 	switch method {
 	case "static":
 		ips := args["--domains.static.values"]
 		if ips == nil {
 			log.Fatal("static ips resolution requires IPs provided on the command line with --domains.static.values option, separated by comas")
 		}
-		return &listener.PollListener{
-			Ticker: ticker,
-			Logger: logger,
-			Poll:   (&lister.Static{Domains: strings.Split(ips.(string), ",")}).List,
-		}
+		return newPollListener(args, "domains", method, ticker, (&lister.Static{Domains: strings.Split(ips.(string), ",")}).List, logger)
 	case "docker":
-		cl, err := client.NewEnvClient()
-		if err != nil {
-			log.Fatalf("Failed to create docker client: %s", err.Error())
-		}
 		d := &docker.Lister{
-			Client: cl,
+			Client: newDockerClient(ctx),
 			Logger: logger,
 		}
 		if args["--domains.docker.watch"].(bool) {
-			ticker = d.EventTicker(ticker)
-		}
-		return &listener.PollListener{
-			Ticker: ticker,
-			Logger: logger,
-			Poll:   d.List,
+			ticker = d.EventTicker(ctx, ticker)
 		}
+		return newPollListener(args, "domains", method, ticker, d.List, logger)
+	case "exec":
+		return newPollListener(args, "domains", method, ticker, (&lister.Exec{Command: newCommand(args, "--domains.exec")}).List, logger)
 	case "k8s":
-		return kubernetes.NewDomainLister(kubernetes.NewClient(), args["--domains.k8s.class"].(string))
+		return kubernetes.NewDomainLister(newKubernetesClient(), args["--domains.k8s.class"].(string))
 	default:
 		log.Fatalf("Unknown IP listener %s", method)
 	}
@@ -155,7 +741,14 @@ func newDomainListener(args map[string]interface{}, ticker <-chan time.Time, met
 
 func main() {
 	usage := `mohotani keeps your DNS records up to date
-	|Usage: mohotani [options]
+	|Usage: mohotani [options] [--ips.http.header=<header>...] [--notify.webhook.header=<header>...]
+	|       mohotani history [<domain>] [options]
+	|       mohotani rollback --to=<point> [options]
+
+	|Commands:
+	|   history                           Print the changes of the records of all domains, or of the given domain, from --journal.file
+	|   rollback                          Apply again the records as they were at --to, and record the changes in --journal.file.
+	|                                     Records of domains changed for the first time after --to are left in place
 
 	|Options:
 	|   --route53                         Use route53 API to update DNS records
@@ -172,33 +765,416 @@ func main() {
 	|   --domains.docker.watch            Refresh domain list everytime a container or service is deployed
 	|   --domains.k8s                     Use kubernetes API to watch ingresses 
 	|   --domains.k8s.class=<class>       The ingress class to watch domain names on [default: nginx]
+	|   --domains.exec=<command>          Use the domains printed by a command, as new line or coma separated values
+	|   --domains.exec.json               Parse the domains printed by the command as a JSON list of strings
+	|   --domains.settle=<delay>          Wait for the domain list not to change for the given delay before updating the DNS records,
+	|                                     0 updates the records on every change (go ParseDuration format) [default: 0s]
+	|   --domains.settle.max=<delay>      The maximum delay of the domain list updates when changes keep coming, 0 disables the limit
+	|                                     (go ParseDuration format) [default: 1m]
 	|   --ips.static                      Use the static IP resolver, with IPs given on the command line
 	|   --ips.static.values=<ips>         The list of domains to be updated, coma separated valuse
 	|   --ips.ipify                       Use ipify resolver to resolve the public IP address
 	|   --ips.ipify.url=<url>             Use a different URL than the default one to reach the IPIFY API
+	|   --ips.metadata                    Use the cloud instance metadata service to resolve the public IP address
+	|   --ips.metadata.cloud=<cloud>      The cloud to query the metadata from, one of ec2, gce, azure, hetzner, digitalocean or auto [default: auto]
+	|   --ips.metadata.url=<url>          Use a different URL than the default one to reach the instance metadata service
+	|   --ips.http=<url>                  Use the IP addresses returned by any http endpoint. By default, the addresses are read from the
+	|                                     response body as plain text, separated by spaces, comas or new lines
+	|   --ips.http.header=<header>        An http header to send, with format <Name>: <value>, can be repeated
+	|   --ips.http.user=<user>            The user name to authenticate to the http endpoint with basic authentication
+	|   --ips.http.password=<password>    The password to authenticate to the http endpoint with basic authentication
+	|   --ips.http.timeout=<timeout>      The timeout of http requests (go ParseDuration format) [default: 10s]
+	|   --ips.http.json=<path>            Read the addresses from a JSON response at the given path, e.g. data.addresses
+	|   --ips.http.regexp=<expression>    Read the addresses from the matches of a regular expression, or from its first capture group
+	|   --ips.hostnames=<names>           Use the IPs the given coma separated hostnames currently resolve to
+	|   --ips.hostnames.server=<address>  The DNS server to resolve hostnames with, with format <host>:<port>. Defaults to the system resolver
+	|   --ips.hostnames.timeout=<timeout> The timeout of hostnames resolution (go ParseDuration format) [default: 5s]
+	|   --ips.exec=<command>              Use the IP addresses printed by a command, as new line or coma separated values
+	|   --ips.exec.json                   Parse the IP addresses printed by the command as a JSON list of strings
+	|   --ips.swarm                       Use the addresses of the swarm nodes running a healthy task of the reverse proxy service
+	|   --ips.swarm.service=<service>     The name of the reverse proxy service [default: traefik]
+	|   --ips.swarm.label=<label>         The node label holding the public address of a node, e.g. mohotani.public-ip.
+	|                                     Nodes without this label are published with their swarm address, when it is publicly routable
+	|   --ips.swarm.watch                 Refresh the node addresses everytime a service, node or container changes
+	|   --ips.k8s.service=<name>          Use the load balancer ingress and external IPs of the given kubernetes service
+	|   --ips.k8s.nodes=<selector>        Use the external IPs of the kubernetes nodes running ready pods matching the given label selector
+	|   --ips.k8s.namespace=<namespace>   The kubernetes namespace of the service or pods to watch IPs for [default: default]
+	|   --exec.timeout=<timeout>          The maximum duration of commands run by --ips.exec and --domains.exec [default: 10s]
+	|   --exec.env=<names>                Coma separated names of environment variables passed to commands, no variable is passed by default
+	|   --ips.ipv6-prefix=<hosts>         Use the addresses of hosts in the currently delegated IPv6 prefix. Hosts are coma separated
+	|                                     <domain>=<interface identifier> values, e.g. www.example.com=::10,nas.example.com=::20
+	|                                     The domains of the hosts are updated, domain listers are ignored
+	|   --ips.ipv6-prefix.interface=<if>  Learn the IPv6 prefix from the global address of a local interface
+	|   --ips.ipv6-prefix.url=<url>       Learn the IPv6 prefix from the address returned by an http endpoint, e.g. https://api6.ipify.org
+	|   --ips.ipv6-prefix.length=<bits>   The length of the delegated IPv6 prefix [default: 64]
+	|   --ips.chain=<methods>             Combine several IP resolution methods, given as coma separated method names, e.g. http,ipify
+	|                                     Each method is configured with its own options
+	|   --ips.chain.policy=<policy>       The policy combining the IP resolution methods of --ips.chain. "first" uses the first
+	|                                     successful method, in order. "union" merges the IPs of all methods [default: first]
+	|   --ips.sticky=<failures>           Keep the last IPs resolved by each method of --ips.chain for up to the given number of its
+	|                                     consecutive failures, instead of falling back to the next method or failing the union [default: 0]
+	|   --ips.stable.polls=<count>        The number of consecutive polls new IPs must be resolved in before being published [default: 1]
+	|   --ips.stable.delay=<delay>        The minimum duration new IPs must be resolved for before being published (go ParseDuration format) [default: 0s]
+	|   --ips.min-interval=<delay>        The minimum interval between two updates of the records of a domain with new IPs
+	|                                     (go ParseDuration format) [default: 0s]
+	|   --ips.allow=<networks>            Coma separated CIDR networks or IPs the resolved IPs must belong to. Addresses of these networks
+	|                                     are accepted even when they are not publicly routable
+	|   --ips.deny=<networks>             Coma separated CIDR networks or IPs the resolved IPs must not belong to
+	|   --ips.allow-bogons                Accept publishing private, loopback, link-local, CGNAT and other not publicly routable IPs
+	|   --ips.allow-empty                 Accept publishing an empty list of IPs
+	|   --healthcheck=<type>              Only publish the IPs passing a health check, one of tcp, http or https
+	|   --healthcheck.port=<port>         The port to check, defaults to the http or https port
+	|   --healthcheck.path=<path>         The path requested by http and https checks [default: /]
+	|   --healthcheck.host=<host>         The host requested by http checks, also used as TLS server name by https checks
+	|   --healthcheck.status=<code>       The http status code healthy targets answer [default: 200]
+	|   --healthcheck.insecure            Do not verify the certificates of https targets
+	|   --healthcheck.timeout=<timeout>   The timeout of each check (go ParseDuration format) [default: 2s]
+	|   --healthcheck.interval=<delay>    The interval between checks (go ParseDuration format) [default: 10s]
+	|   --healthcheck.rise=<count>        The number of consecutive successful checks before a target is healthy again [default: 2]
+	|   --healthcheck.fall=<count>        The number of consecutive failed checks before a target is unhealthy [default: 3]
+	|   --healthcheck.fallback=<ips>      Coma separated IPs published when no target is healthy. The last healthy IPs are kept by default
 	|   --watch.delay=<delay>             The interval at which IP or Domain list polling should occur (go ParseDuration format) [default: 5s]
+	|   --watch.timeout=<timeout>         The maximum duration of each IP or Domain list poll (go ParseDuration format) [default: 30s]
+	|   --update.timeout=<timeout>        The maximum duration of each DNS record update (go ParseDuration format) [default: 30s]
+	|   --update.concurrency=<count>      The maximum number of DNS record updates run in parallel [default: 4]
+	|   --update.rate=<rate>              The maximum number of DNS record updates per second, 0 disables the limit.
+	|                                     Defaults to 5 for gandi and 2 for route53
+	|   --update.burst=<count>            The number of DNS record updates allowed in a burst above --update.rate [default: 1]
+	|   --retry.delay=<delay>             The delay before retrying a failed DNS record update, doubled after each failed retry
+	|                                     (go ParseDuration format) [default: 10s]
+	|   --retry.max-delay=<delay>         The maximum delay between two retries of a failed DNS record update (go ParseDuration format) [default: 10m]
+	|   --retry.attempts=<count>          The maximum number of retries of a failed DNS record update, 0 disables retries [default: 10]
+	|   --resync.interval=<delay>         The interval at which the DNS records are read from the provider and repaired when they differ
+	|                                     from the expected IPs, 0 disables resyncs (go ParseDuration format) [default: 1h]
+	|   --update.prune                    Remove the records of domains that are no longer listed, including the ones removed while
+	|                                     mohotani was stopped. Requires a state
+	|   --update.prune.delay=<delay>      The duration a domain must stay unlisted before its records are removed by --update.prune
+	|                                     (go ParseDuration format) [default: 10m]
+	|   --state.file=<path>               Persist the applied records and pending retries in a JSON file, so they survive restarts
+	|   --state.k8s.configmap=<name>      Persist the applied records and pending retries in a kubernetes config map
+	|   --state.k8s.secret=<name>         Persist the applied records and pending retries in a kubernetes secret
+	|   --state.k8s.namespace=<namespace> The kubernetes namespace of the state config map or secret [default: default]
+	|   --state.owner=<name>              The name identifying the records of this instance in the state, instances sharing a state
+	|                                     must have different names [default: mohotani]
+	|   --election.k8s.lease=<name>       Only update the DNS records while holding the given kubernetes lease, other instances stand by
+	|   --election.k8s.namespace=<ns>     The kubernetes namespace of the election lease [default: default]
+	|   --election.file=<path>            Only update the DNS records while holding a lock on the given file, other instances stand by
+	|   --election.id=<identity>          The name of this instance in the election, defaults to the host name
+	|   --election.lease-duration=<delay> The delay before standing by instances take over the lease of a leader that stopped renewing it
+	|                                     (go ParseDuration format) [default: 15s]
+	|   --election.renew-deadline=<delay> The time the leader retries renewing the lease before standing by (go ParseDuration format) [default: 10s]
+	|   --election.retry-period=<delay>   The interval between attempts to acquire the lease or the lock (go ParseDuration format) [default: 2s]
+	|   --http.addr=<address>             Serve the Prometheus metrics on /metrics, and the liveness and readiness probes on /healthz
+	|                                     and /readyz at the given address, e.g. :9090
+	|   --http.probe-timeout=<timeout>    The maximum time the components have to answer the liveness and readiness probes
+	|                                     (go ParseDuration format) [default: 5s]
+	|   --log.format=<format>             The format of the logs, one of text or json [default: text]
+	|   --log.level=<level>               The minimum level of the logs, one of debug, info, warn or error [default: info]
+	|   --notify.webhook=<url>            Post the changes as JSON to the given url
+	|   --notify.webhook.header=<header>  An http header to send with the changes, with format <Name>: <value>, can be repeated
+	|   --notify.webhook.template=<path>  Post the changes rendered with the Go template in the given file instead of JSON
+	|   --notify.slack=<url>              Post the changes to the given Slack or Mattermost incoming webhook
+	|   --notify.slack.url-file=<path>    The path of a file containing the Slack or Mattermost incoming webhook to post the changes to
+	|   --notify.slack.template=<path>    Render the Slack messages with the Go template in the given file
+	|   --notify.smtp=<address>           Mail the changes through the SMTP server at the given <host>:<port>
+	|   --notify.smtp.tls                 Connect to the SMTP server with TLS instead of STARTTLS, always enabled on port 465
+	|   --notify.smtp.from=<address>      The sender of the mails [default: mohotani@localhost]
+	|   --notify.smtp.to=<addresses>      Coma separated recipients of the mails
+	|   --notify.smtp.user=<user>         The user to authenticate to the SMTP server
+	|   --notify.smtp.password=<password> The password to authenticate to the SMTP server
+	|   --notify.smtp.password-file=<path>
+	|                                     The path of a file containing the password to authenticate to the SMTP server
+	|   --notify.smtp.subject=<template>  The Go template of the mail subjects
+	|   --notify.smtp.template=<path>     Render the mail bodies with the Go template in the given file
+	|   --notify.events=<events>          Coma separated changes to notify, among ip-changed, domain-added, domain-removed,
+	|                                     update-failed and recovered [default: ip-changed,domain-added,domain-removed,update-failed,recovered]
+	|   --journal.file=<path>             Append the changes applied to the records and their cause to the given JSON lines file
+	|   --to=<point>                      The journal entry id, or the time in RFC 3339 format, to roll the records back to
+	|   --shutdown.timeout=<timeout>      The time left to in-flight DNS record updates to complete on SIGINT or SIGTERM,
+	|                                     they are cancelled right away when the leadership is lost (go ParseDuration format) [default: 10s]
 	`
 	args, err := docopt.Parse(stripAlign(usage), os.Args[1:], true, "0.0.0", false, true)
 	if err != nil {
 		log.Fatal(err)
 	}
-	duration, err := time.ParseDuration(args["--watch.delay"].(string))
-	if err != nil {
-		log.Fatalf(stripAlign(`Failed to parse duration: %s.
-			|
-			|A duration string is a possibly signed sequence of decimal numbers, each with optional fraction and a unit suffix,
-			|such as "300ms", "-1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".`), err.Error())
+	duration := parseDuration(args, "--watch.delay")
+	updateTimeout := parseDuration(args, "--update.timeout")
+	shutdownTimeout := parseDuration(args, "--shutdown.timeout")
+	retry := newRetryBackoff(args)
+	resyncInterval := parseDuration(args, "--resync.interval")
+	concurrency := parseInt(args, "--update.concurrency")
+	logger := newLogger(args)
+	if args["history"].(bool) {
+		history(args)
+		return
 	}
-	logger := log.New(os.Stdout, "Mohotani: ", log.LstdFlags|log.Llongfile)
 	providerMethod := strings.Replace(oneOf(args, "--gandi", "--log", "--route53"), "--", "", 1)
-	IPListenerMethod := strings.Replace(oneOf(args, "--ips.static", "--ips.ipify"), "--ips.", "", 1)
-	DomainListenerMethod := strings.Replace(oneOf(args, "--domains.static", "--domains.docker", "--domains.k8s"), "--domains.", "", 1)
+	if args["rollback"].(bool) {
+		rollback(handleSignals(logger), args, newDNSUpdater(args, providerMethod, logger), providerMethod, updateTimeout, logger)
+		return
+	}
+	limiter := newLimiter(args, providerMethod)
+	owner := args["--state.owner"].(string)
+	prune := args["--update.prune"].(bool)
+	notifier := newNotifier(args)
+	changes := newJournal(args)
+	IPListenerMethods := []string{}
+	if chain := args["--ips.chain"]; chain != nil {
+		IPListenerMethods = strings.Split(chain.(string), ",")
+	} else {
+		IPListenerMethods = append(IPListenerMethods, strings.Replace(oneOf(args, "--ips.static", "--ips.ipify", "--ips.metadata", "--ips.http", "--ips.hostnames", "--ips.exec", "--ips.swarm", "--ips.k8s.service", "--ips.k8s.nodes", "--ips.ipv6-prefix"), "--ips.", "", 1))
+	}
+
+	ctx := handleSignals(logger)
+	live := &probe.Handler{Timeout: parseDuration(args, "--http.probe-timeout")}
+	ready := &probe.Handler{Timeout: parseDuration(args, "--http.probe-timeout")}
+	serveHTTP(ctx, args, live, ready, logger)
+	dnsUpdater := newDNSUpdater(args, providerMethod, logger)
+	// updaters are instanciated for each leadership term, as informers can not be restarted,
+	// and the state is loaded again as it may have been changed by the previous leader.
+	// Their tickers and clients are stopped once ctx is done, in-flight updates are given the shutdown timeout
+	// to complete unless abort is closed
+	newUpdaters := func(ctx context.Context, abort <-chan struct{}) []*updater.Updater {
+		registry := newState(args, logger)
+		updaters := []*updater.Updater{}
+		if IPListenerMethods[0] == "ipv6-prefix" {
+			prefix := newIPv6Prefix(args)
+			// the prefix is polled once for all hosts
+			prefixes := &listener.Broadcast{Listener: newIPPollListener(args, "ipv6-prefix", newTicker(ctx, duration), pollIPv6Prefix(prefix), logger)}
+			go prefixes.Run(ctx)
+			for _, host := range strings.Split(args["--ips.ipv6-prefix"].(string), ",") {
+				kv := strings.SplitN(host, "=", 2)
+				if len(kv) != 2 {
+					log.Fatalf("Invalid IPv6 host %s, hosts must have format <domain>=<interface identifier>", host)
+				}
+				resolver, err := prefix.Host(kv[1])
+				if err != nil {
+					log.Fatalf("Invalid IPv6 host %s: %s", host, err.Error())
+				}
+				updaters = append(updaters, &updater.Updater{
+					Updater:         dnsUpdater,
+					IPListener:      newCheckedIPListener(ctx, args, "ipv6-prefix", prefixes.Subscribe(hostAddresses(resolver)), logger),
+					DomainListener:  newPollListener(args, "domains", "static", newTicker(ctx, duration), (&lister.Static{Domains: []string{kv[0]}}).List, logger),
+					Logger:          logger,
+					Timeout:         updateTimeout,
+					ShutdownTimeout: shutdownTimeout,
+					Abort:           abort,
+					Retry:           retry,
+					MinInterval:     parseDuration(args, "--ips.min-interval"),
+					Resync:          newResyncTicker(ctx, resyncInterval),
+					Concurrency:     concurrency,
+					Limiter:         limiter,
+					State:           registry,
+					Provider:        providerMethod,
+					Owner:           owner + "/" + kv[0],
+					Prune:           prune,
+					PruneDelay:      parseDuration(args, "--update.prune.delay"),
+					Notifier:        notifier,
+					Journal:         changes,
+				})
+			}
+		} else {
+			DomainListenerMethod := strings.Replace(oneOf(args, "--domains.static", "--domains.docker", "--domains.k8s", "--domains.exec"), "--domains.", "", 1)
+			updaters = append(updaters, &updater.Updater{
+				Updater:         dnsUpdater,
+				IPListener:      newCheckedIPListener(ctx, args, strings.Join(IPListenerMethods, ","), newIPListener(ctx, args, newTicker(ctx, duration), IPListenerMethods, logger), logger),
+				DomainListener:  newSettledListener(args, newDomainListener(ctx, args, newTicker(ctx, duration), DomainListenerMethod, logger)),
+				Logger:          logger,
+				Timeout:         updateTimeout,
+				ShutdownTimeout: shutdownTimeout,
+				Abort:           abort,
+				Retry:           retry,
+				MinInterval:     parseDuration(args, "--ips.min-interval"),
+				Resync:          newResyncTicker(ctx, resyncInterval),
+				Concurrency:     concurrency,
+				Limiter:         limiter,
+				State:           registry,
+				Provider:        providerMethod,
+				Owner:           owner,
+				Prune:           prune,
+				PruneDelay:      parseDuration(args, "--update.prune.delay"),
+				Notifier:        notifier,
+				Journal:         changes,
+			})
+		}
+		return updaters
+	}
+	elector := newElector(args, logger)
+	if elector == nil {
+		if !start(ctx, newUpdaters(ctx, nil), live, ready, logger) {
+			os.Exit(1)
+		}
+		return
+	}
+	ready.Set("election", func(ctx context.Context) (interface{}, error) {
+		return map[string]bool{"leader": elector.IsLeader()}, nil
+	})
+	succeeded := true
+	err = elector.Run(ctx, func(term context.Context) {
+		// another instance may lead as soon as the leadership is lost, in-flight updates are then cancelled right away.
+		// They are given the shutdown timeout when the term ends because mohotani stops
+		lost := make(chan struct{})
+		go func() {
+			<-term.Done()
+			if ctx.Err() == nil {
+				close(lost)
+			}
+		}()
+		succeeded = start(term, newUpdaters(term, lost), live, ready, logger)
+	})
+	if err != nil {
+		log.Fatalf("Failed to run the leader election: %s", err.Error())
+	}
+	if !succeeded {
+		os.Exit(1)
+	}
+}
+
+// handleSignals returns a context cancelled on SIGINT or SIGTERM.
+// A second signal exits immediately
+func handleSignals(l logger.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		l.Info("received signal, shutting down", logger.F("signal", s))
+		cancel()
+		s = <-signals
+		l.Warn("received signal again, exiting now", logger.F("signal", s))
+		os.Exit(1)
+	}()
+	return ctx
+}
 
-	u := &updater.Updater{
-		Updater:        newDNSUpdater(args, providerMethod, logger),
-		IPListener:     newIPListener(args, time.NewTicker(duration).C, IPListenerMethod, logger),
-		DomainListener: newDomainListener(args, time.NewTicker(duration).C, DomainListenerMethod, logger),
-		Logger:         logger,
+// serveHTTP serves the metrics and the liveness and readiness probes on --http.addr until ctx is done,
+// nothing is served when no address is given
+func serveHTTP(ctx context.Context, args map[string]interface{}, live, ready *probe.Handler, l logger.Logger) {
+	addr := args["--http.addr"]
+	if addr == nil {
+		return
+	}
+	socket, err := net.Listen("tcp", addr.(string))
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %s", addr.(string), err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", live)
+	mux.Handle("/readyz", ready)
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := server.Serve(socket); err != nil && err != http.ErrServerClosed {
+			l.Error("failed to serve http", logger.F("address", addr), logger.Err(err))
+		}
+	}()
+}
+
+// start runs all updaters until ctx is done and returns whether their last reconciliation succeeded.
+// The updaters are checked by the live and ready probes once started, until they stop
+func start(ctx context.Context, updaters []*updater.Updater, live, ready *probe.Handler, l logger.Logger) bool {
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(updaters))
+	for _, u := range updaters {
+		u := u
+		name := "updater " + u.Owner
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := make(chan error, 1)
+			go func() {
+				done <- u.Start(ctx)
+			}()
+			select {
+			case <-u.Started():
+			case err := <-done:
+				errs <- err
+				return
+			}
+			live.Set(name, func(ctx context.Context) (interface{}, error) {
+				return nil, u.Alive()
+			})
+			ready.Set(name, func(ctx context.Context) (interface{}, error) {
+				status, err := u.Status(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return status, status.Ready()
+			})
+			defer live.Delete(name)
+			defer ready.Delete(name)
+			errs <- <-done
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := true
+	for err := range errs {
+		if err != nil {
+			l.Error("last reconciliation failed", logger.Err(err))
+			succeeded = false
+		}
+	}
+	return succeeded
+}
+
+// history prints the entries of --journal.file changing the records of <domain>, or of all domains
+func history(args map[string]interface{}) {
+	entries, err := requireJournal(args).Entries()
+	if err != nil {
+		log.Fatal(err)
+	}
+	domain := ""
+	if d := args["<domain>"]; d != nil {
+		domain = d.(string)
+	}
+	printEntries(journal.History(entries, domain))
+}
+
+// rollback applies again through dnsUpdater the records of --journal.file as they were at --to, each update being limited to timeout.
+// The rolled back records are recorded in the state, when one is given
+func rollback(ctx context.Context, args map[string]interface{}, dnsUpdater provider.Updater, name string, timeout time.Duration, logger logger.Logger) {
+	registry := newState(args, logger)
+	applied, err := requireJournal(args).Rollback(ctx, dnsUpdater, registry, name, args["--to"].(string), timeout)
+	if len(applied) > 0 {
+		printEntries(applied)
+	} else if err == nil {
+		fmt.Println("The records already match the journal, nothing to roll back")
+	}
+	if registry != nil {
+		if err := registry.Flush(ctx); err != nil {
+			log.Fatalf("Failed to save the state: %s", err.Error())
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to roll back the records: %s", err.Error())
+	}
+}
+
+// printEntries prints journal entries as a table on the standard output
+func printEntries(entries []journal.Entry) {
+	values := func(IPs []string, removed bool) string {
+		if removed {
+			return "removed"
+		}
+		if len(IPs) == 0 {
+			return "-"
+		}
+		return strings.Join(IPs, ",")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tPROVIDER\tOWNER\tDOMAIN\tPREVIOUS\tTARGETS\tCAUSE")
+	for _, entry := range entries {
+		owner := entry.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Time.Format(time.RFC3339), entry.Provider, owner, entry.Domain,
+			values(entry.Previous, false), values(entry.IPs, entry.Removed), entry.Cause)
 	}
-	u.Start()
+	w.Flush()
 }
@@ -0,0 +1,97 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Command runs an external command and parses its standard output as a list of values
+type Command struct {
+	// Path is the command to run, looked up in the PATH when it is not a path
+	Path string
+	Args []string
+	// Timeout is the maximum duration of the command, no timeout is applied when zero
+	Timeout time.Duration
+	// Env is the list of environment variable names passed from the current environment to the command.
+	// Other variables are not passed to the command
+	Env []string
+	// JSON parses the output as a JSON list of strings instead of new line or coma separated values
+	JSON bool
+}
+
+// Shell returns a command running script with sh, so its arguments can be quoted and shell features used
+func Shell(script string) *Command {
+	return &Command{Path: "sh", Args: []string{"-c", script}}
+}
+
+func (c *Command) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+func (c *Command) env() []string {
+	env := []string{}
+	for _, name := range c.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// Run runs the command and returns the values it printed.
+// The command exiting with a non-zero code, exceeding its timeout or being cancelled, is an error
+func (c *Command) Run(ctx context.Context) ([]string, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Env = c.env()
+	// do not wait for children still holding the output once the command is killed
+	cmd.WaitDelay = 100 * time.Millisecond
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded && c.Timeout > 0 {
+		return nil, fmt.Errorf("command '%s' did not complete within %s", c, c.Timeout)
+	}
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), fmt.Sprintf("command '%s' did not complete", c))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("command '%s' failed, stderr: %s", c, strings.TrimSpace(stderr.String())))
+	}
+	return c.parse(stdout.Bytes())
+}
+
+func (c *Command) parse(output []byte) ([]string, error) {
+	if c.JSON {
+		values := []string{}
+		err := json.Unmarshal(output, &values)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse output of command '%s', expecting a JSON list of strings", c))
+		}
+		return values, nil
+	}
+	values := []string{}
+	for _, value := range strings.FieldsFunc(string(output), func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
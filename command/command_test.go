@@ -0,0 +1,77 @@
+package command
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sh(script string) *Command {
+	c := Shell(script)
+	c.Env = []string{"PATH"}
+	return c
+}
+
+func TestRun(t *testing.T) {
+	values, err := sh(`printf "a.example.com\nb.example.com, c.example.com\n\n"`).Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com", "b.example.com", "c.example.com"}, values)
+
+	c := sh(`echo '["203.0.113.1", "2001:db8::1"]'`)
+	c.JSON = true
+	values, err = c.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "2001:db8::1"}, values)
+
+	values, err = sh(`true`).Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, values)
+
+	// commands are run without environment, with the default search path of sh
+	values, err = Shell(`printf '%s\n' "quoted argument" 'and $PATH'`).Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"quoted argument", "and $PATH"}, values)
+}
+
+func TestRunEnv(t *testing.T) {
+	os.Setenv("MOHOTANI_TEST_ALLOWED", "allowed")
+	os.Setenv("MOHOTANI_TEST_DENIED", "denied")
+	defer os.Unsetenv("MOHOTANI_TEST_ALLOWED")
+	defer os.Unsetenv("MOHOTANI_TEST_DENIED")
+
+	c := sh(`echo "$MOHOTANI_TEST_ALLOWED,$MOHOTANI_TEST_DENIED,$MOHOTANI_TEST_UNSET"`)
+	c.Env = append(c.Env, "MOHOTANI_TEST_ALLOWED", "MOHOTANI_TEST_UNSET")
+	values, err := c.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"allowed"}, values)
+}
+
+func TestRunErrors(t *testing.T) {
+	values, err := sh(`echo partial; echo "something went wrong" >&2; exit 3`).Run(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, values)
+	assert.Contains(t, err.Error(), "something went wrong")
+	assert.Contains(t, err.Error(), "exit status 3")
+
+	c := sh(`echo '{"not": "a list"}'`)
+	c.JSON = true
+	values, err = c.Run(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, values)
+
+	c = sh(`sleep 5`)
+	c.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	values, err = c.Run(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, values)
+	assert.Contains(t, err.Error(), "50ms")
+	assert.True(t, time.Since(start) < 3*time.Second)
+
+	values, err = (&Command{Path: "/this/command/should/not/exist"}).Run(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, values)
+}
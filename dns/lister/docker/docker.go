@@ -17,39 +17,42 @@ type Lister struct {
 	Logger logger.Logger
 }
 
-func (d *Lister) logErrors(t string, c <-chan error) {
+func logErrors(ctx context.Context, l logger.Logger, t string, c <-chan error) {
 	for e := range c {
-		d.Logger.Printf("warning: Got an error while getting %s events: %s", t, e.Error())
+		if ctx.Err() != nil {
+			return
+		}
+		l.Warn("failed to get docker events", logger.F("type", t), logger.Err(e))
 	}
 }
 
 // List implements the Lister interface to list required domains
 // for all containers and services
-func (d *Lister) List() ([]string, error) {
+func (d *Lister) List(ctx context.Context) ([]string, error) {
 	domains := map[string]interface{}{}
-	containers, err := d.Client.ContainerList(context.Background(), types.ContainerListOptions{})
+	containers, err := d.Client.ContainerList(ctx, types.ContainerListOptions{})
 	if err != nil {
 		return nil, err
 	}
 	for _, container := range containers {
 		newDomains, err := ExtractTraefikDomainsFromLabels(container.Labels)
 		if err != nil {
-			d.Logger.Printf("Failed to extract domain names for container %s, %s", container.Names, err.Error())
+			d.Logger.Warn("failed to extract domain names from container labels", logger.F("container", container.Names), logger.Err(err))
 		}
 		for _, domain := range newDomains {
 			domains[domain] = nil
 		}
 	}
-	_, err = d.Client.SwarmInspect(context.Background())
+	_, err = d.Client.SwarmInspect(ctx)
 	if err == nil {
-		services, err := d.Client.ServiceList(context.Background(), types.ServiceListOptions{})
+		services, err := d.Client.ServiceList(ctx, types.ServiceListOptions{})
 		if err != nil {
 			return nil, err
 		}
 		for _, service := range services {
 			newDomains, err := ExtractTraefikDomainsFromLabels(service.Spec.Labels)
 			if err != nil {
-				d.Logger.Printf("Failed to extract domain names for container %s, %s", service.Spec.Name, err.Error())
+				d.Logger.Warn("failed to extract domain names from service labels", logger.F("service", service.Spec.Name), logger.Err(err))
 			}
 			for _, domain := range newDomains {
 				domains[domain] = nil
@@ -64,26 +67,51 @@ func (d *Lister) List() ([]string, error) {
 }
 
 // EventTicker proxies a ticker and adds ticks for each container and service events
-func (d *Lister) EventTicker(c <-chan time.Time) <-chan time.Time {
-	f := filters.NewArgs()
-	f.Add("type", "service")
-	serviceMessages, serviceErrors := d.Client.Events(context.Background(), types.EventsOptions{Filters: f})
-	f = filters.NewArgs()
-	f.Add("type", "container")
-	containerMessages, containerErrors := d.Client.Events(context.Background(), types.EventsOptions{Filters: f})
-	go d.logErrors("service", serviceErrors)
-	go d.logErrors("container", containerErrors)
+// until ctx is done
+func (d *Lister) EventTicker(ctx context.Context, c <-chan time.Time) <-chan time.Time {
+	return EventTicker(ctx, d.Client, d.Logger, c, "service", "container")
+}
+
+// EventTicker proxies a ticker and adds ticks for each docker event of the given types
+// until ctx is done
+func EventTicker(ctx context.Context, cl *client.Client, l logger.Logger, c <-chan time.Time, eventTypes ...string) <-chan time.Time {
 	o := make(chan time.Time)
+	tick := func(t time.Time) bool {
+		select {
+		case o <- t:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for _, t := range eventTypes {
+		f := filters.NewArgs()
+		f.Add("type", t)
+		messages, errs := cl.Events(ctx, types.EventsOptions{Filters: f})
+		go logErrors(ctx, l, t, errs)
+		go func() {
+			for {
+				select {
+				case _, ok := <-messages:
+					if !ok || !tick(time.Now()) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
 	go func() {
 		log.Println("starting docker event ticker")
 		for {
 			select {
-			case <-serviceMessages:
-				o <- time.Now()
-			case <-containerMessages:
-				o <- time.Now()
 			case t := <-c:
-				o <- t
+				if !tick(t) {
+					return
+				}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
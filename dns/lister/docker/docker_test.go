@@ -17,6 +17,8 @@ import (
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
 )
 
 type testDockerDaemon struct {
@@ -129,9 +131,9 @@ func TestNoSwarm(t *testing.T) {
 	startContainer(t, h.dockerDaemonClient, "alpine", []string{"tail", "-f", "/dev/null"}, []string{}, false, map[string]string{"traefik.frontend.rule": "Host: www.example.com, traefik.io"})
 	lister := Lister{
 		Client: h.dockerDaemonClient,
-		Logger: testLogger{},
+		Logger: logger.FromPrintf(testLogger{}),
 	}
-	domains, err := lister.List()
+	domains, err := lister.List(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count(domains, "traefik.io"))
 	assert.Equal(t, 1, count(domains, "www.traefik.io"))
@@ -162,9 +164,9 @@ func TestSwarm(t *testing.T) {
 	fmt.Println(r)
 	lister := Lister{
 		Client: h.dockerDaemonClient,
-		Logger: testLogger{},
+		Logger: logger.FromPrintf(testLogger{}),
 	}
-	domains, err := lister.List()
+	domains, err := lister.List(context.Background())
 	assert.NoError(t, err)
 	fmt.Println(domains)
 	assert.Equal(t, 1, count(domains, "traefik.io"))
@@ -0,0 +1,17 @@
+package lister
+
+import (
+	"context"
+
+	"github.com/tjamet/mohotani/command"
+)
+
+// Exec is a lister that runs an external command to get the domains
+type Exec struct {
+	command.Command
+}
+
+// List implements the Lister interface
+func (e *Exec) List(ctx context.Context) ([]string, error) {
+	return e.Command.Run(ctx)
+}
@@ -0,0 +1,21 @@
+package lister
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tjamet/mohotani/command"
+)
+
+func TestListExec(t *testing.T) {
+	e := Exec{command.Command{Path: "echo", Args: []string{`["www.example.com", "api.example.com"]`}, JSON: true}}
+	domains, err := e.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com", "api.example.com"}, domains)
+
+	e = Exec{command.Command{Path: "false"}}
+	domains, err = e.List(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, domains)
+}
@@ -1,7 +1,12 @@
 package lister
 
+import (
+	"context"
+)
+
 // Lister defines methods an object must implement to list all required domains
 type Lister interface {
 	// List returns all domain names all required domains
-	List() ([]string, error)
+	// ctx is done when the poll times out, the listener keeps the last domains when listing fails
+	List(ctx context.Context) ([]string, error)
 }
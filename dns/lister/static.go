@@ -1,11 +1,15 @@
 package lister
 
+import (
+	"context"
+)
+
 // Static is a resolver that have static IPs
 type Static struct {
 	Domains []string
 }
 
 // List implements the Lister interface
-func (s *Static) List() ([]string, error) {
+func (s *Static) List(ctx context.Context) ([]string, error) {
 	return s.Domains, nil
 }
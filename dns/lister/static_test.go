@@ -1,6 +1,7 @@
 package lister
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,7 +9,7 @@ import (
 
 func TestRListStatic(t *testing.T) {
 	s := Static{[]string{"www.thib-o.eu"}}
-	domains, err := s.List()
+	domains, err := s.List(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"www.thib-o.eu"}, domains)
 
@@ -17,7 +18,7 @@ func TestRListStatic(t *testing.T) {
 		{"test.example.org", "test.example.com"},
 	} {
 		s.Domains = expectedDomains
-		domains, err = s.List()
+		domains, err = s.List(context.Background())
 		assert.NoError(t, err)
 		assert.Equal(t, expectedDomains, domains)
 	}
@@ -1,6 +1,7 @@
 package gandi
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -8,6 +9,7 @@ import (
 	gclient "github.com/prasmussen/gandi-api/client"
 	gdomain "github.com/prasmussen/gandi-api/live_dns/domain"
 	grecord "github.com/prasmussen/gandi-api/live_dns/record"
+	"github.com/tjamet/mohotani/dns/provider"
 )
 
 type domainLister interface {
@@ -23,7 +25,11 @@ type domainAccessor interface {
 	recordAccessor
 }
 
-// Gandi implements the updater interface for gandi liveDNS API
+// UpdateRate is the default maximum number of updates per second.
+// Each update makes up to 3 calls to the liveDNS API
+const UpdateRate = 5
+
+// Gandi implements the updater interface for gandi liveDNS API, IPv6 addresses are set as AAAA records
 type Gandi struct {
 	domainAccessor
 }
@@ -36,11 +42,35 @@ func New(key string) *Gandi {
 	}
 }
 
-// Update updates DNS records for the given domain
-func (g *Gandi) Update(domain string, ips ...string) error {
-	domains, err := g.domainAccessor.List()
+// call runs f, a call to the liveDNS API, and gives up waiting for it once ctx is done.
+// The gandi client does not support cancellation, a call given up on completes in the background
+func call(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// record returns the base domain and the record name of domain
+func (g *Gandi) record(ctx context.Context, domain string) (string, string, error) {
+	var domains []*gdomain.InfoBase
+	err := call(ctx, func() error {
+		var err error
+		domains, err = g.domainAccessor.List()
+		return err
+	})
+	provider.Observe("gandi", "list domains", err)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("unable to find base domain for '%s'", domain))
+		return "", "", errors.Wrap(err, fmt.Sprintf("unable to find base domain for '%s'", domain))
 	}
 	var baseDomain *gdomain.InfoBase
 	for _, d := range domains {
@@ -54,15 +84,112 @@ func (g *Gandi) Update(domain string, ips ...string) error {
 		for _, d := range domains {
 			availableDomains = append(availableDomains, d.Fqdn)
 		}
-		return fmt.Errorf("no base domain found for '%s' using gandi API, found domains: [%s]", domain, strings.Join(availableDomains, ","))
+		return "", "", fmt.Errorf("no base domain found for '%s' using gandi API, found domains: [%s]", domain, strings.Join(availableDomains, ","))
 	}
 	r := strings.TrimSuffix(strings.TrimSuffix(domain, baseDomain.Fqdn), ".")
 	if len(r) == 0 {
-		return fmt.Errorf("unable to update the root domain of %s", domain)
+		return "", "", fmt.Errorf("unable to update the root domain of %s", domain)
+	}
+	return baseDomain.Fqdn, r, nil
+}
+
+// Update updates DNS records for the given domain
+func (g *Gandi) Update(ctx context.Context, domain string, ips ...string) error {
+	baseDomain, r, err := g.record(ctx, domain)
+	if err != nil {
+		return err
+	}
+	ipv4, ipv6 := provider.SplitIPs(ips)
+	for _, record := range []struct {
+		t      string
+		values []string
+	}{{grecord.A, ipv4}, {grecord.AAAA, ipv6}} {
+		if len(record.values) == 0 {
+			continue
+		}
+		values, t := record.values, record.t
+		err = call(ctx, func() error {
+			_, err := g.domainAccessor.Records(baseDomain).Update(grecord.Info{Values: values}, r, t)
+			return err
+		})
+		provider.Observe("gandi", "update record", err)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to update %s record infos for domain '%s' with ips %s", record.t, domain, strings.Join(record.values, ",")))
+		}
+	}
+	return nil
+}
+
+// records lists the records of the record name r of baseDomain
+func (g *Gandi) records(ctx context.Context, baseDomain, r string) ([]*grecord.Info, error) {
+	var records []*grecord.Info
+	err := call(ctx, func() error {
+		var err error
+		records, err = g.domainAccessor.Records(baseDomain).List(r)
+		return err
+	})
+	return records, err
+}
+
+// Get implements the provider.Reader interface and returns the values of the A and AAAA records of domain
+func (g *Gandi) Get(ctx context.Context, domain string) ([]string, error) {
+	baseDomain, r, err := g.record(ctx, domain)
+	if err != nil {
+		return nil, err
 	}
-	_, err = g.domainAccessor.Records(baseDomain.Fqdn).Update(grecord.Info{Values: ips}, r, grecord.A)
+	records, err := g.records(ctx, baseDomain, r)
+	provider.Observe("gandi", "list records", err)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("unable to update record infos for domain '%s' with ips %s", domain, strings.Join(ips, ",")))
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to get records of domain '%s'", domain))
+	}
+	values := []string{}
+	for _, record := range records {
+		if record.Type == grecord.A || record.Type == grecord.AAAA {
+			values = append(values, record.Values...)
+		}
+	}
+	return values, nil
+}
+
+// Remove implements the provider.Remover interface and deletes the given values from the A and AAAA records of domain.
+// Records left without values are deleted, other values are left in place
+func (g *Gandi) Remove(ctx context.Context, domain string, ips ...string) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	baseDomain, r, err := g.record(ctx, domain)
+	if err != nil {
+		return err
+	}
+	records, err := g.records(ctx, baseDomain, r)
+	provider.Observe("gandi", "list records", err)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to remove records of domain '%s'", domain))
+	}
+	for _, record := range records {
+		if record.Type != grecord.A && record.Type != grecord.AAAA {
+			continue
+		}
+		remaining := provider.Remaining(record.Values, ips)
+		if len(remaining) == len(record.Values) {
+			continue
+		}
+		t := record.Type
+		if len(remaining) > 0 {
+			err = call(ctx, func() error {
+				_, err := g.domainAccessor.Records(baseDomain).Update(grecord.Info{Values: remaining}, r, t)
+				return err
+			})
+			provider.Observe("gandi", "update record", err)
+		} else {
+			err = call(ctx, func() error {
+				return g.domainAccessor.Records(baseDomain).Delete(r, t)
+			})
+			provider.Observe("gandi", "delete record", err)
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to remove %s record of domain '%s'", record.Type, domain))
+		}
 	}
-	return err
+	return nil
 }
@@ -1,8 +1,10 @@
 package gandi
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	gdomain "github.com/prasmussen/gandi-api/live_dns/domain"
 	grecord "github.com/prasmussen/gandi-api/live_dns/record"
@@ -13,15 +15,23 @@ type testDomainClient struct {
 	domains []*gdomain.InfoBase
 	err     error
 	record  *testRecordClient
+	// block, when set, blocks List until it is closed
+	block chan struct{}
 }
 type testRecordClient struct {
 	status        grecord.Status
 	err           error
 	updatedValues grecord.Info
 	args          []string
+	records       []*grecord.Info
+	listArgs      []string
+	deleted       [][]string
 }
 
 func (t *testDomainClient) List() ([]*gdomain.InfoBase, error) {
+	if t.block != nil {
+		<-t.block
+	}
 	return t.domains, t.err
 }
 func (t *testDomainClient) Records(string) grecord.Manager {
@@ -36,10 +46,12 @@ func (t *testRecordClient) Update(recordInfo grecord.Info, args ...string) (*gre
 	return &t.status, t.err
 }
 func (t *testRecordClient) List(args ...string) ([]*grecord.Info, error) {
-	return nil, nil
+	t.listArgs = args
+	return t.records, t.err
 }
 func (t *testRecordClient) Delete(args ...string) error {
-	return nil
+	t.deleted = append(t.deleted, args)
+	return t.err
 }
 
 func TestUpdateError(t *testing.T) {
@@ -51,7 +63,7 @@ func TestUpdateError(t *testing.T) {
 	gandi := Gandi{
 		&c,
 	}
-	err := gandi.Update("test.example.com", "127.0.0.1")
+	err := gandi.Update(context.Background(), "test.example.com", "127.0.0.1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "test.example.com")
 	assert.Contains(t, err.Error(), "base domain")
@@ -65,7 +77,7 @@ func TestUpdateError(t *testing.T) {
 		},
 	}
 	c.err = nil
-	err = gandi.Update("test.example.com", "127.0.0.1")
+	err = gandi.Update(context.Background(), "test.example.com", "127.0.0.1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "example.cat")
 	assert.Contains(t, err.Error(), "example.fr")
@@ -80,13 +92,13 @@ func TestUpdateError(t *testing.T) {
 			Fqdn: "example.com",
 		},
 	}
-	err = gandi.Update("example.com", "127.0.0.1")
+	err = gandi.Update(context.Background(), "example.com", "127.0.0.1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "example.com")
 	assert.Contains(t, err.Error(), "root domain")
 
 	c.record.err = fmt.Errorf("test error")
-	err = gandi.Update("test.example.com", "127.0.0.1")
+	err = gandi.Update(context.Background(), "test.example.com", "127.0.0.1")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "test.example.com")
 	assert.Contains(t, err.Error(), "127.0.0.1")
@@ -94,10 +106,124 @@ func TestUpdateError(t *testing.T) {
 
 	c.record.updatedValues = grecord.Info{}
 	c.record.err = nil
-	err = gandi.Update("test.example.com", "127.0.0.1")
+	err = gandi.Update(context.Background(), "test.example.com", "127.0.0.1")
 	assert.NoError(t, err)
 	assert.Equal(t, grecord.Info{Values: []string{"127.0.0.1"}}, c.record.updatedValues)
 	assert.Equal(t, []string{"test", "A"}, c.record.args)
+
+	err = gandi.Update(context.Background(), "test.example.com", "2001:db8::1", "2001:db8::2")
+	assert.NoError(t, err)
+	assert.Equal(t, grecord.Info{Values: []string{"2001:db8::1", "2001:db8::2"}}, c.record.updatedValues)
+	assert.Equal(t, []string{"test", "AAAA"}, c.record.args)
+
+	c.record.err = fmt.Errorf("test error")
+	err = gandi.Update(context.Background(), "test.example.com", "2001:db8::1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "AAAA")
+
+	c.record.err = nil
+	c.record.updatedValues = grecord.Info{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = gandi.Update(ctx, "test.example.com", "127.0.0.1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "canceled")
+	assert.Equal(t, grecord.Info{}, c.record.updatedValues)
+}
+
+func TestHungAPI(t *testing.T) {
+	c := testDomainClient{
+		domains: []*gdomain.InfoBase{{Fqdn: "example.com"}},
+		record:  &testRecordClient{},
+		block:   make(chan struct{}),
+	}
+	defer close(c.block)
+	gandi := Gandi{
+		&c,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := gandi.Update(ctx, "test.example.com", "203.0.113.1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "deadline exceeded")
+	assert.True(t, time.Since(start) < time.Second, "the update did not give up when its context was done")
+	assert.Nil(t, c.record.args)
+}
+
+func TestGet(t *testing.T) {
+	c := testDomainClient{
+		domains: []*gdomain.InfoBase{{Fqdn: "example.com"}},
+		record: &testRecordClient{
+			records: []*grecord.Info{
+				{Type: grecord.A, Values: []string{"203.0.113.1", "203.0.113.2"}},
+				{Type: grecord.MX, Values: []string{"10 mail.example.com."}},
+				{Type: grecord.AAAA, Values: []string{"2001:db8::1"}},
+			},
+		},
+	}
+	gandi := Gandi{
+		&c,
+	}
+	values, err := gandi.Get(context.Background(), "test.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2", "2001:db8::1"}, values)
+	assert.Equal(t, []string{"test"}, c.record.listArgs)
+
+	c.record.err = fmt.Errorf("test error")
+	values, err = gandi.Get(context.Background(), "test.example.com")
+	assert.Error(t, err)
+	assert.Nil(t, values)
+	assert.Contains(t, err.Error(), "test.example.com")
+
+	values, err = gandi.Get(context.Background(), "test.example.net")
+	assert.Error(t, err)
+	assert.Nil(t, values)
+	assert.Contains(t, err.Error(), "base domain")
+}
+
+func TestRemove(t *testing.T) {
+	c := testDomainClient{
+		domains: []*gdomain.InfoBase{{Fqdn: "example.com"}},
+		record: &testRecordClient{
+			records: []*grecord.Info{
+				{Type: grecord.A, Values: []string{"203.0.113.1"}},
+				{Type: grecord.MX, Values: []string{"10 mail.example.com."}},
+				{Type: grecord.AAAA, Values: []string{"2001:db8::1", "2001:db8::2"}},
+			},
+		},
+	}
+	gandi := Gandi{
+		&c,
+	}
+	assert.NoError(t, gandi.Remove(context.Background(), "test.example.com", "203.0.113.1", "2001:db8::1"))
+	assert.Equal(t, [][]string{{"test", grecord.A}}, c.record.deleted)
+	// values that were not given are left in place
+	assert.Equal(t, []string{"test", grecord.AAAA}, c.record.args)
+	assert.Equal(t, []string{"2001:db8::2"}, c.record.updatedValues.Values)
+
+	// records without any of the values are not changed
+	c.record.deleted = nil
+	c.record.args = nil
+	assert.NoError(t, gandi.Remove(context.Background(), "test.example.com", "198.51.100.1"))
+	assert.Nil(t, c.record.deleted)
+	assert.Nil(t, c.record.args)
+	c.record.listArgs = nil
+	assert.NoError(t, gandi.Remove(context.Background(), "test.example.com"))
+	assert.Nil(t, c.record.listArgs)
+
+	c.record.err = fmt.Errorf("test error")
+	err := gandi.Remove(context.Background(), "test.example.com", "203.0.113.1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "test.example.com")
+
+	c.record.err = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = gandi.Remove(ctx, "test.example.com", "203.0.113.1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "canceled")
+	assert.Nil(t, c.record.deleted)
 }
 
 func TestNew(t *testing.T) {
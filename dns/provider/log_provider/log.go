@@ -1,7 +1,7 @@
 package logProvider
 
 import (
-	"strings"
+	"context"
 
 	"github.com/tjamet/mohotani/logger"
 )
@@ -12,7 +12,13 @@ type Log struct {
 }
 
 // Update updates DNS records for the given domain
-func (l *Log) Update(domain string, ips ...string) error {
-	l.Logger.Printf("Update domain IPS: %s: %s", domain, strings.Join(ips, ", "))
+func (l *Log) Update(ctx context.Context, domain string, ips ...string) error {
+	l.Logger.Info("update records", logger.Domain(domain), logger.IPs(ips))
+	return nil
+}
+
+// Remove removes the given values from the DNS records of the given domain
+func (l *Log) Remove(ctx context.Context, domain string, ips ...string) error {
+	l.Logger.Info("remove records", logger.Domain(domain), logger.IPs(ips))
 	return nil
 }
@@ -1,7 +1,94 @@
+// Package provider defines the interfaces of the DNS providers.
+// Their methods are called with a context limited to the update timeout, and cancelled on shutdown,
+// implementations should give up when it is done
 package provider
 
-// Updater is the interface to update the A DNS records
+import (
+	"context"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/tjamet/mohotani/metrics"
+)
+
+var (
+	apiCalls  = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_provider_api_calls_total", Help: "The number of calls to the API of the DNS provider"}, []string{"provider", "call"})
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_provider_api_errors_total", Help: "The number of failed calls to the API of the DNS provider"}, []string{"provider", "call"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(apiCalls, apiErrors)
+}
+
+// Observe counts a call to the API of a DNS provider, failed when err is not nil, and returns err
+func Observe(provider, call string, err error) error {
+	apiCalls.WithLabelValues(provider, call).Inc()
+	if err != nil {
+		apiErrors.WithLabelValues(provider, call).Inc()
+	}
+	return err
+}
+
+// Updater is the interface to update the A and AAAA DNS records
 type Updater interface {
 	// Update provides the ability to update a domain name with several IPs
-	Update(domain string, ips ...string) error
+	Update(ctx context.Context, domain string, ips ...string) error
+}
+
+// Reader is the interface of updaters able to read the current records of a domain
+type Reader interface {
+	// Get returns the values of the records of a domain managed by Update
+	Get(ctx context.Context, domain string) ([]string, error)
+}
+
+// Remover is the interface of updaters able to remove the records of a domain
+type Remover interface {
+	// Remove deletes the given values from the records of a domain managed by Update,
+	// records left without values are deleted and other values are left in place
+	Remove(ctx context.Context, domain string, ips ...string) error
+}
+
+// SplitIPs splits ips between IPv4 addresses, to be set as A records, and IPv6 addresses, to be set as AAAA records
+func SplitIPs(ips []string) (ipv4, ipv6 []string) {
+	ipv4 = []string{}
+	ipv6 = []string{}
+	for _, ip := range ips {
+		if address := net.ParseIP(ip); address != nil && address.To4() == nil {
+			ipv6 = append(ipv6, ip)
+		} else {
+			ipv4 = append(ipv4, ip)
+		}
+	}
+	return ipv4, ipv6
+}
+
+// Vanished returns the values of previous in an address family ips has no value in.
+// Update leaves the records of such a family in place, they are stale
+func Vanished(previous, ips []string) []string {
+	ipv4, ipv6 := SplitIPs(ips)
+	previous4, previous6 := SplitIPs(previous)
+	vanished := []string{}
+	if len(ipv4) == 0 {
+		vanished = append(vanished, previous4...)
+	}
+	if len(ipv6) == 0 {
+		vanished = append(vanished, previous6...)
+	}
+	return vanished
+}
+
+// Remaining returns the values of values that are not in ips
+func Remaining(values, ips []string) []string {
+	removed := map[string]bool{}
+	for _, ip := range ips {
+		removed[ip] = true
+	}
+	remaining := []string{}
+	for _, value := range values {
+		if !removed[value] {
+			remaining = append(remaining, value)
+		}
+	}
+	return remaining
 }
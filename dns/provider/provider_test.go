@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitIPs(t *testing.T) {
+	ipv4, ipv6 := SplitIPs([]string{"203.0.113.1", "2001:db8::1", "203.0.113.2", "::ffff:203.0.113.3"})
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2", "::ffff:203.0.113.3"}, ipv4)
+	assert.Equal(t, []string{"2001:db8::1"}, ipv6)
+
+	ipv4, ipv6 = SplitIPs(nil)
+	assert.Equal(t, []string{}, ipv4)
+	assert.Equal(t, []string{}, ipv6)
+}
+
+func TestVanished(t *testing.T) {
+	assert.Equal(t, []string{"2001:db8::1"}, Vanished([]string{"203.0.113.1", "2001:db8::1"}, []string{"203.0.113.2"}))
+	assert.Equal(t, []string{"203.0.113.1"}, Vanished([]string{"203.0.113.1", "2001:db8::1"}, []string{"2001:db8::2"}))
+	assert.Equal(t, []string{}, Vanished([]string{"203.0.113.1", "2001:db8::1"}, []string{"203.0.113.2", "2001:db8::2"}))
+	assert.Equal(t, []string{}, Vanished(nil, []string{"203.0.113.2"}))
+}
+
+func TestRemaining(t *testing.T) {
+	assert.Equal(t, []string{"203.0.113.2"}, Remaining([]string{"203.0.113.1", "203.0.113.2"}, []string{"203.0.113.1", "2001:db8::1"}))
+	assert.Equal(t, []string{}, Remaining([]string{"203.0.113.1"}, []string{"203.0.113.1"}))
+}
+
+func TestObserve(t *testing.T) {
+	// the counters outlive the test in the default registry, only their increments are checked
+	calls := testutil.ToFloat64(apiCalls.WithLabelValues("test", "list"))
+	errors := testutil.ToFloat64(apiErrors.WithLabelValues("test", "list"))
+	assert.NoError(t, Observe("test", "list", nil))
+	err := fmt.Errorf("test error")
+	assert.Equal(t, err, Observe("test", "list", err))
+	assert.Equal(t, calls+2, testutil.ToFloat64(apiCalls.WithLabelValues("test", "list")))
+	assert.Equal(t, errors+1, testutil.ToFloat64(apiErrors.WithLabelValues("test", "list")))
+}
@@ -1,6 +1,7 @@
 package route53
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
@@ -9,8 +10,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/tjamet/mohotani/dns/provider"
 )
 
+// UpdateRate is the default maximum number of updates per second.
+// Route53 allows 5 API requests per second per account, and each update makes 2 of them
+const UpdateRate = 2
+
 type Route53 struct {
 	client *route53.Route53
 }
@@ -25,7 +31,7 @@ func NewRoute53() *Route53 {
 	return &Route53{svc}
 }
 
-func (r53 *Route53) Update(domain string, targets ...string) error {
+func (r53 *Route53) Update(ctx context.Context, domain string, targets ...string) error {
 	if len(targets) == 0 {
 		return fmt.Errorf("no target provided, abording")
 	}
@@ -41,47 +47,175 @@ func (r53 *Route53) Update(domain string, targets ...string) error {
 	if isCNAME && len(targets) != 1 {
 		return fmt.Errorf("cannot set CNAME to multiple domains %v", targets)
 	}
-	t := "CNAME"
-	if !isCNAME {
-		t = "A"
+	recordSets := map[string][]string{}
+	if isCNAME {
+		recordSets["CNAME"] = targets
+	} else {
+		ipv4, ipv6 := provider.SplitIPs(targets)
+		recordSets["A"] = ipv4
+		recordSets["AAAA"] = ipv6
 	}
-	records := []*route53.ResourceRecord{}
-	for _, tgt := range targets {
-		records = append(records,
-			&route53.ResourceRecord{ // Required
-				Value: aws.String(tgt), // Required
+	changes := []*route53.Change{}
+	for _, t := range []string{"CNAME", "A", "AAAA"} {
+		if len(recordSets[t]) == 0 {
+			continue
+		}
+		records := []*route53.ResourceRecord{}
+		for _, tgt := range recordSets[t] {
+			records = append(records,
+				&route53.ResourceRecord{ // Required
+					Value: aws.String(tgt), // Required
+				},
+			)
+		}
+		changes = append(changes, &route53.Change{ // Required
+			Action: aws.String("UPSERT"), // Required
+			ResourceRecordSet: &route53.ResourceRecordSet{ // Required
+				Name:            aws.String(domain), // Required
+				Type:            aws.String(t),      // Required
+				ResourceRecords: records,
+				TTL:             aws.Int64(60),
+				Weight:          aws.Int64(100),
+				SetIdentifier:   aws.String("Updated by mohotani"),
 			},
-		)
+		})
 	}
 
-	zones, err := r53.client.ListHostedZones(&route53.ListHostedZonesInput{})
+	zone, err := r53.zone(ctx, domain)
 	if err != nil {
 		return err
 	}
+	params := &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{ // Required
+			Changes: changes, // Required
+			Comment: aws.String("Updated by mohotani"),
+		},
+		HostedZoneId: zone.Id, // Required
+	}
+	_, err = r53.client.ChangeResourceRecordSetsWithContext(ctx, params)
+	return provider.Observe("route53", "change record sets", err)
+}
+
+func (r53 *Route53) zone(ctx context.Context, domain string) (*route53.HostedZone, error) {
+	zones, err := r53.client.ListHostedZonesWithContext(ctx, &route53.ListHostedZonesInput{})
+	provider.Observe("route53", "list hosted zones", err)
+	if err != nil {
+		return nil, err
+	}
 	for _, zone := range zones.HostedZones {
 		if strings.HasSuffix(domain, *zone.Name) {
-			params := &route53.ChangeResourceRecordSetsInput{
-				ChangeBatch: &route53.ChangeBatch{ // Required
-					Changes: []*route53.Change{ // Required
-						{ // Required
-							Action: aws.String("UPSERT"), // Required
-							ResourceRecordSet: &route53.ResourceRecordSet{ // Required
-								Name:            aws.String(domain), // Required
-								Type:            aws.String(t),      // Required
-								ResourceRecords: records,
-								TTL:             aws.Int64(60),
-								Weight:          aws.Int64(100),
-								SetIdentifier:   aws.String("Updated by mohotani"),
-							},
-						},
-					},
-					Comment: aws.String("Updated by mohotani"),
-				},
-				HostedZoneId: zone.Id, // Required
+			return zone, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown zone for host %s", domain)
+}
+
+// recordSets returns the CNAME, A and AAAA record sets of domain set by mohotani, domain ending with a dot
+func (r53 *Route53) recordSets(ctx context.Context, zone *route53.HostedZone, domain string) ([]*route53.ResourceRecordSet, error) {
+	sets := []*route53.ResourceRecordSet{}
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    zone.Id,
+		StartRecordName: aws.String(domain),
+	}
+	err := r53.client.ListResourceRecordSetsPagesWithContext(ctx, input, func(output *route53.ListResourceRecordSetsOutput, last bool) bool {
+		for _, set := range output.ResourceRecordSets {
+			if aws.StringValue(set.Name) != domain {
+				return false
 			}
-			_, err := r53.client.ChangeResourceRecordSets(params)
-			return err
+			if aws.StringValue(set.SetIdentifier) != "Updated by mohotani" {
+				continue
+			}
+			switch aws.StringValue(set.Type) {
+			case "CNAME", "A", "AAAA":
+				sets = append(sets, set)
+			}
+		}
+		return true
+	})
+	provider.Observe("route53", "list record sets", err)
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// Get implements the provider.Reader interface and returns the values of the CNAME, A and AAAA records
+// of domain set by mohotani
+func (r53 *Route53) Get(ctx context.Context, domain string) ([]string, error) {
+	if !strings.HasSuffix(domain, ".") {
+		domain = domain + "."
+	}
+	zone, err := r53.zone(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := r53.recordSets(ctx, zone, domain)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, set := range sets {
+		for _, record := range set.ResourceRecords {
+			values = append(values, aws.StringValue(record.Value))
+		}
+	}
+	return values, nil
+}
+
+// Remove implements the provider.Remover interface and deletes the given values from the CNAME, A and AAAA records
+// of domain set by mohotani. Record sets left without values are deleted, other values are left in place
+func (r53 *Route53) Remove(ctx context.Context, domain string, targets ...string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	if !strings.HasSuffix(domain, ".") {
+		domain = domain + "."
+	}
+	zone, err := r53.zone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	sets, err := r53.recordSets(ctx, zone, domain)
+	if err != nil {
+		return err
+	}
+	changes := []*route53.Change{}
+	for _, set := range sets {
+		values := []string{}
+		for _, record := range set.ResourceRecords {
+			values = append(values, aws.StringValue(record.Value))
+		}
+		remaining := provider.Remaining(values, targets)
+		if len(remaining) == len(values) {
+			continue
 		}
+		if len(remaining) == 0 {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: set,
+			})
+			continue
+		}
+		records := []*route53.ResourceRecord{}
+		for _, value := range remaining {
+			records = append(records, &route53.ResourceRecord{Value: aws.String(value)})
+		}
+		update := *set
+		update.ResourceRecords = records
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: &update,
+		})
+	}
+	if len(changes) == 0 {
+		return nil
 	}
-	return fmt.Errorf("unknown zone for host %s", domain)
+	_, err = r53.client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: changes,
+			Comment: aws.String("Removed by mohotani"),
+		},
+		HostedZoneId: zone.Id,
+	})
+	return provider.Observe("route53", "change record sets", err)
 }
@@ -0,0 +1,30 @@
+package updater
+
+import (
+	"github.com/tjamet/mohotani/journal"
+	"github.com/tjamet/mohotani/logger"
+)
+
+// record appends the change applied by r to Journal.
+// The previous values are the records read on resync, or the values of the last journaled change of the domain
+func (u *Updater) record(r result) {
+	if u.Journal == nil {
+		return
+	}
+	entry := journal.Entry{
+		Provider: u.Provider,
+		Owner:    u.Owner,
+		Domain:   r.domain,
+		Previous: r.actual,
+		Cause:    r.cause,
+		Attempt:  r.attempt,
+	}
+	if r.remove {
+		entry.Removed = true
+	} else {
+		entry.IPs = r.IPs
+	}
+	if _, err := u.Journal.Append(entry); err != nil {
+		u.log.Error("failed to journal the change of the records", logger.Domain(r.domain), logger.Err(err))
+	}
+}
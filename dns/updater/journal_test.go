@@ -0,0 +1,111 @@
+package updater
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/journal"
+	"github.com/tjamet/mohotani/logger"
+)
+
+func newTestJournal(t *testing.T) (*journal.Journal, func()) {
+	dir, err := ioutil.TempDir("", "mohotani-journal")
+	assert.NoError(t, err)
+	j, err := journal.Open(filepath.Join(dir, "journal.jsonl"))
+	assert.NoError(t, err)
+	return j, func() { os.RemoveAll(dir) }
+}
+
+// expectJournal waits for the journal to hold the expected entries after skip entries, in any order, ignoring their ids and times
+func expectJournal(t *testing.T, j *journal.Journal, skip int, expected ...journal.Entry) {
+	t.Helper()
+	var entries []journal.Entry
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		all, err := j.Entries()
+		assert.NoError(t, err)
+		if len(all) >= skip+len(expected) {
+			entries = all[skip:]
+			break
+		}
+	}
+	for i := range entries {
+		assert.False(t, entries[i].Time.IsZero())
+		entries[i].ID = 0
+		entries[i].Time = time.Time{}
+	}
+	assert.ElementsMatch(t, expected, entries)
+}
+
+func TestUpdaterJournal(t *testing.T) {
+	p := &removableUpdater{&flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}}
+	j, clean := newTestJournal(t)
+	defer clean()
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		Retry:    &Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond, MaxAttempts: 10},
+		State:    newTestRegistry(t, nil),
+		Prune:    true,
+		Journal:  j,
+		Provider: "gandi",
+		Owner:    "mohotani",
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+	expectJournal(t, j, 0,
+		journal.Entry{Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Cause: journal.DomainAdded},
+		journal.Entry{Provider: "gandi", Owner: "mohotani", Domain: "www2.example.com", IPs: []string{"203.0.113.1"}, Cause: journal.DomainAdded},
+	)
+
+	// failed updates are only journaled once retried successfully
+	p.fail("www2.example.com", 1)
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]")
+	expectJournal(t, j, 2,
+		journal.Entry{Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", Previous: []string{"203.0.113.1"}, IPs: []string{"203.0.113.2"}, Cause: journal.IPChanged},
+		journal.Entry{Provider: "gandi", Owner: "mohotani", Domain: "www2.example.com", Previous: []string{"203.0.113.1"}, IPs: []string{"203.0.113.2"}, Cause: journal.IPChanged, Attempt: 1},
+	)
+
+	domainListenerChannel <- []string{"www.example.com"}
+	expectCalls(t, p.calls, "remove www2.example.com=[203.0.113.2]")
+	expectJournal(t, j, 4,
+		journal.Entry{Provider: "gandi", Owner: "mohotani", Domain: "www2.example.com", Previous: []string{"203.0.113.2"}, Removed: true, Cause: journal.DomainRemoved},
+	)
+}
+
+func TestUpdaterJournalResync(t *testing.T) {
+	p := &testRecords{records: map[string][]string{}, updates: make(chan string, 100)}
+	j, clean := newTestJournal(t)
+	defer clean()
+	resync := make(chan time.Time)
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		Resync:   resync,
+		Journal:  j,
+		Provider: "gandi",
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com"}
+	expectCalls(t, p.updates, "www.example.com=[203.0.113.1]")
+
+	// the previous values of a repair are the drifted records
+	p.set("www.example.com", "198.51.100.1")
+	resync <- time.Now()
+	expectCalls(t, p.updates, "www.example.com=[203.0.113.1]")
+	expectJournal(t, j, 1,
+		journal.Entry{Provider: "gandi", Domain: "www.example.com", Previous: []string{"198.51.100.1"}, IPs: []string{"203.0.113.1"}, Cause: journal.Drift},
+	)
+}
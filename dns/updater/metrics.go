@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/tjamet/mohotani/metrics"
+)
+
+var (
+	callDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mohotani_provider_call_duration_seconds",
+		Help:    "The duration of the calls to the DNS provider, by operation and domain",
+		Buckets: metrics.DefaultBuckets,
+	}, []string{"provider", "operation", "domain"})
+	callErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mohotani_provider_call_errors_total",
+		Help: "The number of failed calls to the DNS provider, by operation and domain",
+	}, []string{"provider", "operation", "domain"})
+	managedDomains = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mohotani_managed_domains",
+		Help: "The number of domains whose records are managed",
+	}, []string{"updater"})
+	pendingRetries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mohotani_pending_retries",
+		Help: "The number of failed updates waiting to be retried",
+	}, []string{"updater"})
+	lastReconciliation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mohotani_last_reconciliation_timestamp_seconds",
+		Help: "The time the records of all domains were last found up to date",
+	}, []string{"updater"})
+	publishedIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mohotani_published_ip_info",
+		Help: "The IPs the records of the domains are set to",
+	}, []string{"updater", "ip"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(callDuration, callErrors, managedDomains, pendingRetries, lastReconciliation, publishedIPs)
+}
+
+// publish records IPs as the published IPs in metrics
+func (u *Updater) publish(IPs []string) {
+	for _, ip := range u.published {
+		publishedIPs.DeleteLabelValues(u.Owner, ip)
+	}
+	for _, ip := range IPs {
+		publishedIPs.WithLabelValues(u.Owner, ip).Set(1)
+	}
+	u.published = IPs
+}
+
+// observe updates the metrics of the updater.
+// The reconciliation time is updated when the records of all domains are up to date after a change or a provider call
+func (u *Updater) observe() {
+	managedDomains.WithLabelValues(u.Owner).Set(float64(len(u.desired)))
+	pendingRetries.WithLabelValues(u.Owner).Set(float64(u.PendingRetries()))
+	if u.progressed && u.reconciled() {
+		lastReconciliation.WithLabelValues(u.Owner).SetToCurrentTime()
+		u.progressed = false
+	}
+}
+
+// reconciled returns whether the records of all domains are up to date, with no pending job
+func (u *Updater) reconciled() bool {
+	if len(u.desired) == 0 || len(u.queue) > 0 || len(u.inflight) > 0 || len(u.failures) > 0 {
+		return false
+	}
+	for domain, IPs := range u.desired {
+		if applied, ok := u.applied[domain]; !ok || !sameValues(applied, IPs) {
+			return false
+		}
+	}
+	return true
+}
+
+// unobserve drops the metrics of the updater once stopped
+func (u *Updater) unobserve() {
+	u.publish(nil)
+	managedDomains.DeleteLabelValues(u.Owner)
+	pendingRetries.DeleteLabelValues(u.Owner)
+	lastReconciliation.DeleteLabelValues(u.Owner)
+}
@@ -0,0 +1,89 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/metrics"
+)
+
+// expectMetrics waits for the default registry to expose the expected lines, and none of the unexpected ones
+func expectMetrics(t *testing.T, expected []string, unexpected ...string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		body, err := metrics.Text()
+		assert.NoError(t, err)
+		missing := []string{}
+		for _, line := range expected {
+			if !strings.Contains(body, line) {
+				missing = append(missing, line)
+			}
+		}
+		for _, line := range unexpected {
+			if strings.Contains(body, line) {
+				missing = append(missing, "no "+line)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("expected metrics %v in:\n%s", missing, body)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUpdaterMetrics(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	p.fail("www2.example.com", 1)
+	// the provider counters outlive the test in the default registry, each run counts them under its own provider
+	provider := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		Retry:    &Backoff{Initial: time.Hour, Max: time.Hour, MaxAttempts: 10},
+		Provider: provider,
+		Owner:    "metrics",
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+	expectMetrics(t, []string{
+		`mohotani_managed_domains{updater="metrics"} 2`,
+		`mohotani_pending_retries{updater="metrics"} 1`,
+		`mohotani_published_ip_info{ip="203.0.113.1",updater="metrics"} 1`,
+		fmt.Sprintf(`mohotani_provider_call_duration_seconds_count{domain="www.example.com",operation="update",provider="%s"} 1`, provider),
+		fmt.Sprintf(`mohotani_provider_call_duration_seconds_count{domain="www2.example.com",operation="update",provider="%s"} 1`, provider),
+		fmt.Sprintf(`mohotani_provider_call_errors_total{domain="www2.example.com",operation="update",provider="%s"} 1`, provider),
+	}, `mohotani_last_reconciliation_timestamp_seconds{updater="metrics"}`)
+
+	// the records are reconciled once the failed domain is updated
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]")
+	expectMetrics(t, []string{
+		`mohotani_pending_retries{updater="metrics"} 0`,
+		`mohotani_published_ip_info{ip="203.0.113.2",updater="metrics"} 1`,
+		`mohotani_last_reconciliation_timestamp_seconds{updater="metrics"}`,
+	}, `mohotani_published_ip_info{ip="203.0.113.1",updater="metrics"}`)
+
+	// the metrics of the updater are dropped once stopped
+	stop()
+	expectMetrics(t, []string{
+		fmt.Sprintf(`mohotani_provider_call_duration_seconds_count{domain="www.example.com",operation="update",provider="%s"} 2`, provider),
+	},
+		`mohotani_managed_domains{updater="metrics"}`,
+		`mohotani_published_ip_info{ip="203.0.113.2",updater="metrics"}`,
+		`mohotani_last_reconciliation_timestamp_seconds{updater="metrics"}`,
+	)
+	assert.Equal(t, 0, u.PendingRetries())
+}
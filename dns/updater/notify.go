@@ -0,0 +1,90 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/notify"
+)
+
+// notifications is the maximum number of events waiting to be sent to Notifier
+const notifications = 100
+
+// notify queues an event to be sent to Notifier, it is dropped when too many events are waiting
+func (u *Updater) notify(event notify.Event) {
+	if u.Notifier == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Owner = u.Owner
+	event.Provider = u.Provider
+	select {
+	case u.events <- event:
+	default:
+		u.log.Warn("too many notifications pending, dropping one", eventFields(event)...)
+	}
+}
+
+// deliver sends the events to Notifier until the events channel is closed, each notification being limited to Timeout
+func (u *Updater) deliver(ctx context.Context, events <-chan notify.Event) {
+	for event := range events {
+		if err := u.send(ctx, event); err != nil {
+			u.log.Error("failed to notify", append(eventFields(event), logger.Err(err))...)
+		}
+	}
+}
+
+// eventFields returns the log fields of an event
+func eventFields(event notify.Event) []logger.Field {
+	fields := []logger.Field{logger.F("event", event.Kind)}
+	if event.Domain != "" {
+		fields = append(fields, logger.Domain(event.Domain))
+	}
+	return fields
+}
+
+func (u *Updater) send(ctx context.Context, event notify.Event) error {
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	return u.Notifier.Notify(ctx, event)
+}
+
+// notifyIPs notifies the change of the IPs, nothing is notified when the IPs are first received
+func (u *Updater) notifyIPs(previous, IPs []string) {
+	if previous == nil || IPs == nil || sameValues(previous, IPs) {
+		return
+	}
+	u.notify(notify.Event{Kind: notify.IPChanged, IPs: IPs, PreviousIPs: previous})
+}
+
+// notifyDomains notifies the added and removed domains, nothing is notified when the domains are first received
+func (u *Updater) notifyDomains(previous, domains []string) {
+	if previous == nil || domains == nil {
+		return
+	}
+	for _, domain := range missing(domains, previous) {
+		u.notify(notify.Event{Kind: notify.DomainAdded, Domain: domain})
+	}
+	for _, domain := range missing(previous, domains) {
+		u.notify(notify.Event{Kind: notify.DomainRemoved, Domain: domain})
+	}
+}
+
+// missing returns the values of a that are not in b
+func missing(a, b []string) []string {
+	in := map[string]bool{}
+	for _, value := range b {
+		in[value] = true
+	}
+	values := []string{}
+	for _, value := range a {
+		if !in[value] {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,113 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/notify"
+)
+
+type testNotifier struct {
+	events chan notify.Event
+}
+
+func (n *testNotifier) Notify(ctx context.Context, event notify.Event) error {
+	n.events <- event
+	return nil
+}
+
+// expectEvents checks that exactly the expected events are notified, in order, ignoring their time
+func expectEvents(t *testing.T, c chan notify.Event, expected ...notify.Event) {
+	t.Helper()
+	var events []notify.Event
+	for len(events) < len(expected) {
+		select {
+		case event := <-c:
+			assert.False(t, event.Time.IsZero())
+			event.Time = time.Time{}
+			events = append(events, event)
+		case <-time.After(3 * time.Second):
+			t.Errorf("Timeout waiting for events %v, got %v", expected, events)
+			return
+		}
+	}
+	select {
+	case event := <-c:
+		t.Errorf("Unexpected event %v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Equal(t, expected, events)
+}
+
+func TestUpdaterNotify(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	n := &testNotifier{events: make(chan notify.Event, 100)}
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		Retry:    &Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond, MaxAttempts: 10},
+		Notifier: n,
+		Provider: "gandi",
+		Owner:    "mohotani",
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	// nothing is notified when the IPs and domains are first received
+	domainListenerChannel <- []string{"www.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]")
+	expectEvents(t, n.events)
+
+	domainListenerChannel <- []string{"www2.example.com", "www3.example.com"}
+	expectCalls(t, p.calls, "www2.example.com=[203.0.113.1]", "www3.example.com=[203.0.113.1]")
+	expectEvents(t, n.events,
+		notify.Event{Kind: notify.DomainAdded, Owner: "mohotani", Provider: "gandi", Domain: "www2.example.com"},
+		notify.Event{Kind: notify.DomainAdded, Owner: "mohotani", Provider: "gandi", Domain: "www3.example.com"},
+		notify.Event{Kind: notify.DomainRemoved, Owner: "mohotani", Provider: "gandi", Domain: "www.example.com"},
+	)
+
+	// only the first failure is notified until the domain recovers
+	p.fail("www2.example.com", 2)
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls,
+		"www2.example.com=[203.0.113.2]", "www3.example.com=[203.0.113.2]",
+		"www2.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]",
+	)
+	expectEvents(t, n.events,
+		notify.Event{Kind: notify.IPChanged, Owner: "mohotani", Provider: "gandi", IPs: []string{"203.0.113.2"}, PreviousIPs: []string{"203.0.113.1"}},
+		notify.Event{Kind: notify.UpdateFailed, Owner: "mohotani", Provider: "gandi", Domain: "www2.example.com", IPs: []string{"203.0.113.2"}, Error: "test error"},
+		notify.Event{Kind: notify.Recovered, Owner: "mohotani", Provider: "gandi", Domain: "www2.example.com", IPs: []string{"203.0.113.2"}, Attempt: 2},
+	)
+
+	// the same IPs are not notified again
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectEvents(t, n.events)
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(ctx context.Context, event notify.Event) error {
+	return fmt.Errorf("test error")
+}
+
+func TestUpdaterNotifyFailure(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	l := &testLogger{messages: make(chan string, 100)}
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(l),
+		Notifier: failingNotifier{},
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+	domainListenerChannel <- []string{"www.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	ipListenerChannel <- []string{"203.0.113.2"}
+	assert.Equal(t, `error: failed to notify event=ip-changed error="test error"`, l.find("failed to notify"))
+}
@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type testRecords struct {
+	lock    sync.Mutex
+	records map[string][]string
+	err     error
+	updates chan string
+}
+
+func (r *testRecords) Update(ctx context.Context, domain string, ips ...string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records[domain] = ips
+	r.updates <- fmt.Sprintf("%s=%v", domain, ips)
+	return nil
+}
+
+func (r *testRecords) Get(ctx context.Context, domain string) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.records[domain], r.err
+}
+
+func (r *testRecords) set(domain string, values ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records[domain] = values
+}
+
+func TestDrifted(t *testing.T) {
+	assert.False(t, drifted([]string{"203.0.113.1", "203.0.113.2"}, []string{"203.0.113.2", "203.0.113.1"}))
+	assert.True(t, drifted([]string{"203.0.113.1", "203.0.113.2"}, []string{"203.0.113.1"}))
+	assert.True(t, drifted([]string{"203.0.113.1"}, []string{}))
+	assert.False(t, drifted([]string{"203.0.113.1"}, []string{"203.0.113.1", "2001:db8::1"}))
+	assert.True(t, drifted([]string{"203.0.113.1", "2001:db8::2"}, []string{"203.0.113.1", "2001:db8::1"}))
+}
+
+func TestUpdaterResync(t *testing.T) {
+	p := &testRecords{records: map[string][]string{}, updates: make(chan string, 100)}
+	l := &testLogger{messages: make(chan string, 100)}
+	resync := make(chan time.Time)
+	u := Updater{
+		Updater: p,
+		Logger:  logger.FromPrintf(l),
+		Resync:  resync,
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	// resync before the desired state is known does nothing
+	resync <- time.Now()
+
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	expectCalls(t, p.updates, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+
+	resync <- time.Now()
+	expectCalls(t, p.updates)
+
+	p.set("www2.example.com", "198.51.100.1")
+	resync <- time.Now()
+	expectCalls(t, p.updates, "www2.example.com=[203.0.113.1]")
+	assert.Contains(t, l.find("drifted"), "warning: records drifted, restoring them domain=www2.example.com records=198.51.100.1 ips=203.0.113.1")
+
+	p.lock.Lock()
+	p.err = fmt.Errorf("test error")
+	p.lock.Unlock()
+	resync <- time.Now()
+	expectCalls(t, p.updates)
+	assert.Contains(t, l.find("failed to read"), "test error")
+}
+
+type testLogger struct {
+	messages chan string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.messages <- fmt.Sprintf(format, v...)
+}
+
+// find returns the first logged message containing pattern
+func (l *testLogger) find(pattern string) string {
+	for {
+		select {
+		case m := <-l.messages:
+			if strings.Contains(m, pattern) {
+				return m
+			}
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+}
+
+func TestUpdaterResyncUnsupported(t *testing.T) {
+	l := &testLogger{messages: make(chan string, 100)}
+	u := Updater{
+		Updater: blockingUpdater{},
+		Logger:  logger.FromPrintf(l),
+		Resync:  make(chan time.Time),
+	}
+	_, _, stop := startUpdater(t, &u)
+	defer stop()
+	assert.Contains(t, l.find("resync"), "resync is disabled")
+}
@@ -0,0 +1,113 @@
+package updater
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/tjamet/mohotani/journal"
+	"github.com/tjamet/mohotani/logger"
+)
+
+// DefaultBackoff is the backoff applied to retries of failed updates when not overridden
+var DefaultBackoff = Backoff{
+	Initial:     10 * time.Second,
+	Max:         10 * time.Minute,
+	Multiplier:  2,
+	Jitter:      0.2,
+	MaxAttempts: 10,
+}
+
+// random returns a random number in [0.0,1.0), it is overridden in tests
+var random = rand.Float64
+
+// Backoff defines the delays between the retries of a failed update
+type Backoff struct {
+	// Initial is the delay before the first retry
+	Initial time.Duration
+	// Max is the maximum delay between two retries, no maximum is applied when zero
+	Max time.Duration
+	// Multiplier is the factor applied to the delay after each retry, defaults to 2
+	Multiplier float64
+	// Jitter is the fraction of the delay randomly added or removed, e.g. 0.2 for +/-20%
+	Jitter float64
+	// MaxAttempts is the maximum number of retries of an update, retries are unlimited when zero
+	MaxAttempts int
+}
+
+// Delay returns the delay before the given retry attempt, starting at 1
+func (b Backoff) Delay(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < attempt && (b.Max == 0 || delay < float64(b.Max)); i++ {
+		delay *= multiplier
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	delay += delay * b.Jitter * (2*random() - 1)
+	return time.Duration(delay)
+}
+
+// retry is a scheduled retry of the update of a domain
+type retry struct {
+	domain  string
+	attempt int
+	cause   journal.Cause
+	timer   *time.Timer
+}
+
+// schedule plans the next retry of the update of domain caused by cause, after attempt failed retries.
+// It returns false when the maximum number of attempts is reached
+func (u *Updater) schedule(due chan<- *retry, stopped <-chan struct{}, domain string, attempt int, cause journal.Cause) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.cancelRetry(domain)
+	if u.Retry.MaxAttempts > 0 && attempt >= u.Retry.MaxAttempts {
+		return false
+	}
+	r := &retry{domain: domain, attempt: attempt + 1, cause: cause}
+	delay := u.Retry.Delay(r.attempt)
+	r.timer = time.AfterFunc(delay, func() {
+		select {
+		case due <- r:
+		case <-stopped:
+		}
+	})
+	u.retries[domain] = r
+	fields := []logger.Field{logger.Domain(domain), logger.F("delay", delay), logger.F("attempt", r.attempt)}
+	if u.Retry.MaxAttempts > 0 {
+		fields = append(fields, logger.F("maxAttempts", u.Retry.MaxAttempts))
+	}
+	u.log.Info("retrying update", append(fields, logger.F("pending", len(u.retries)))...)
+	return true
+}
+
+// cancelRetry drops any pending retry of domain, u.lock must be held
+func (u *Updater) cancelRetry(domain string) {
+	if r, ok := u.retries[domain]; ok {
+		r.timer.Stop()
+		delete(u.retries, domain)
+	}
+}
+
+// current returns whether r is still the pending retry of its domain, and marks it as running.
+// A retry is stale once a newer desired state was applied to its domain
+func (u *Updater) current(r *retry) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.retries[r.domain] != r {
+		return false
+	}
+	delete(u.retries, r.domain)
+	return true
+}
+
+// PendingRetries returns the number of failed domain updates waiting to be retried
+func (u *Updater) PendingRetries() int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return len(u.retries)
+}
@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	defer func(f func() float64) { random = f }(random)
+	random = func() float64 { return 0.5 }
+
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second}
+	assert.Equal(t, time.Second, b.Delay(1))
+	assert.Equal(t, 2*time.Second, b.Delay(2))
+	assert.Equal(t, 8*time.Second, b.Delay(4))
+	assert.Equal(t, 10*time.Second, b.Delay(5))
+	assert.Equal(t, 10*time.Second, b.Delay(1000))
+
+	b.Multiplier = 3
+	assert.Equal(t, 9*time.Second, b.Delay(3))
+
+	b.Jitter = 0.2
+	random = func() float64 { return 0 }
+	assert.Equal(t, 800*time.Millisecond, b.Delay(1))
+	random = func() float64 { return 0.75 }
+	assert.Equal(t, 1100*time.Millisecond, b.Delay(1))
+}
+
+type flakyUpdater struct {
+	lock     sync.Mutex
+	failures map[string]int
+	calls    chan string
+}
+
+func (f *flakyUpdater) Update(ctx context.Context, domain string, ips ...string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls <- fmt.Sprintf("%s=%v", domain, ips)
+	if f.failures[domain] > 0 {
+		f.failures[domain]--
+		return fmt.Errorf("test error")
+	}
+	return nil
+}
+
+func (f *flakyUpdater) fail(domain string, count int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures[domain] = count
+}
+
+// expectCalls checks that exactly the expected calls are made, in any order
+func expectCalls(t *testing.T, c chan string, expected ...string) {
+	calls := []string{}
+	for range expected {
+		select {
+		case call := <-c:
+			calls = append(calls, call)
+		case <-time.After(3 * time.Second):
+			t.Errorf("Timeout waiting for updates %v, got %v", expected, calls)
+			return
+		}
+	}
+	assert.ElementsMatch(t, expected, calls)
+	select {
+	case call := <-c:
+		t.Errorf("Unexpected update %s", call)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUpdaterRetry(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	u := Updater{
+		Updater: p,
+		Logger:  logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+		Retry:   &Backoff{Initial: 5 * time.Millisecond, Max: 20 * time.Millisecond, MaxAttempts: 3},
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+
+	// failed updates are retried until they succeed
+	p.fail("www.example.com", 2)
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	expectCalls(t, p.calls,
+		"www.example.com=[203.0.113.1]",
+		"www2.example.com=[203.0.113.1]",
+		"www.example.com=[203.0.113.1]",
+		"www.example.com=[203.0.113.1]",
+	)
+	assert.Equal(t, 0, u.PendingRetries())
+
+	// retries stop after the maximum number of attempts
+	p.fail("www.example.com", 10)
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls,
+		"www.example.com=[203.0.113.2]",
+		"www2.example.com=[203.0.113.2]",
+		"www.example.com=[203.0.113.2]",
+		"www.example.com=[203.0.113.2]",
+		"www.example.com=[203.0.113.2]",
+	)
+	assert.Equal(t, 0, u.PendingRetries())
+
+	// a newer desired state cancels the stale retry
+	u.Retry.Initial, u.Retry.Max = time.Hour, time.Hour
+	ipListenerChannel <- []string{"203.0.113.3"}
+	expectCalls(t, p.calls,
+		"www.example.com=[203.0.113.3]",
+		"www2.example.com=[203.0.113.3]",
+	)
+	assert.Equal(t, 1, u.PendingRetries())
+	p.fail("www.example.com", 0)
+	ipListenerChannel <- []string{"203.0.113.4"}
+	expectCalls(t, p.calls,
+		"www.example.com=[203.0.113.4]",
+		"www2.example.com=[203.0.113.4]",
+	)
+	assert.Equal(t, 0, u.PendingRetries())
+
+	// retries of domains no longer listed are dropped
+	p.fail("www2.example.com", 1)
+	ipListenerChannel <- []string{"203.0.113.5"}
+	expectCalls(t, p.calls,
+		"www.example.com=[203.0.113.5]",
+		"www2.example.com=[203.0.113.5]",
+	)
+	assert.Equal(t, 1, u.PendingRetries())
+	domainListenerChannel <- []string{"www.example.com"}
+	expectCalls(t, p.calls)
+	assert.Equal(t, 0, u.PendingRetries())
+
+	assert.NoError(t, stop())
+}
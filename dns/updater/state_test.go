@@ -0,0 +1,208 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/dns/provider"
+	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/state"
+)
+
+type memoryStore struct {
+	lock  sync.Mutex
+	state state.State
+}
+
+func (s *memoryStore) Load(ctx context.Context) (state.State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.state, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, state state.State) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.state = state
+	return nil
+}
+
+type removableUpdater struct {
+	*flakyUpdater
+}
+
+func (r *removableUpdater) Remove(ctx context.Context, domain string, ips ...string) error {
+	r.calls <- fmt.Sprintf("remove %s=%v", domain, ips)
+	return nil
+}
+
+// expectRecords waits for the records of owner in registry to match expected, ignoring the update times
+func expectRecords(t *testing.T, registry *state.Registry, owner string, expected map[string]state.Record) {
+	var records map[string]state.Record
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		records = registry.Records("gandi", owner)
+		for domain, record := range records {
+			record.Updated = time.Time{}
+			records[domain] = record
+		}
+		if reflect.DeepEqual(expected, records) {
+			return
+		}
+	}
+	assert.Equal(t, expected, records)
+}
+
+func newTestRegistry(t *testing.T, records map[string]state.Record) *state.Registry {
+	registry, err := state.Open(context.Background(), &memoryStore{state: state.State{
+		Providers: map[string]map[string]state.Record{"gandi": records},
+	}})
+	assert.NoError(t, err)
+	return registry
+}
+
+func TestUpdaterState(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		prune     bool
+		removable bool
+		calls     []string
+		message   string
+	}{
+		{
+			name:    "records of removed domains are left in place",
+			calls:   []string{"www2.example.com=[203.0.113.1]"},
+			message: "domain is no longer listed, its records are left in place provider=gandi owner=mohotani domain=old.example.com",
+		},
+		{
+			name:      "records of removed domains are pruned",
+			prune:     true,
+			removable: true,
+			calls:     []string{"www2.example.com=[203.0.113.1]", "remove old.example.com=[203.0.113.1]"},
+			message:   "removed records provider=gandi owner=mohotani domain=old.example.com",
+		},
+		{
+			name:    "pruning is disabled when the provider can not remove records",
+			prune:   true,
+			calls:   []string{"www2.example.com=[203.0.113.1]"},
+			message: "domain is no longer listed, its records are left in place provider=gandi owner=mohotani domain=old.example.com",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			registry := newTestRegistry(t, map[string]state.Record{
+				"www.example.com":   {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+				"old.example.com":   {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+				"other.example.com": {IPs: []string{"203.0.113.9"}, Owner: "other"},
+			})
+			l := &testLogger{messages: make(chan string, 100)}
+			p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+			var updater provider.Updater = p
+			if test.removable {
+				updater = &removableUpdater{p}
+			}
+			u := Updater{
+				Updater:  updater,
+				Logger:   logger.FromPrintf(l),
+				State:    registry,
+				Provider: "gandi",
+				Owner:    "mohotani",
+				Prune:    test.prune,
+			}
+			ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+			defer stop()
+
+			// records applied before the restart are not updated again
+			ipListenerChannel <- []string{"203.0.113.1"}
+			domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+			expectCalls(t, p.calls, test.calls...)
+			assert.NotEqual(t, "", l.find(test.message))
+			expectRecords(t, registry, "mohotani", map[string]state.Record{
+				"www.example.com":  {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+				"www2.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+			})
+			expectRecords(t, registry, "other", map[string]state.Record{
+				"other.example.com": {IPs: []string{"203.0.113.9"}, Owner: "other"},
+			})
+		})
+	}
+}
+
+func TestUpdaterStateRetry(t *testing.T) {
+	registry := newTestRegistry(t, map[string]state.Record{
+		"www.example.com":  {Owner: "mohotani", Retry: &state.Retry{IPs: []string{"203.0.113.1"}, Attempt: 2, Error: "test error"}},
+		"www2.example.com": {Owner: "mohotani", Retry: &state.Retry{IPs: []string{"203.0.113.1"}, Attempt: 2, Error: "test error"}},
+	})
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	p.fail("www.example.com", 1)
+	p.fail("www2.example.com", 1)
+	l := &testLogger{messages: make(chan string, 100)}
+	u := Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(l),
+		Retry:    &Backoff{Initial: time.Hour, Max: time.Hour, MaxAttempts: 10},
+		State:    registry,
+		Provider: "gandi",
+		Owner:    "mohotani",
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	// failed updates are retried at startup, the retry attempts go on for the same IPs
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+	expectRecords(t, registry, "mohotani", map[string]state.Record{
+		"www.example.com":  {Owner: "mohotani", Retry: &state.Retry{IPs: []string{"203.0.113.1"}, Attempt: 3, Error: "test error"}},
+		"www2.example.com": {Owner: "mohotani", Retry: &state.Retry{IPs: []string{"203.0.113.1"}, Attempt: 3, Error: "test error"}},
+	})
+	assert.Equal(t, 2, u.PendingRetries())
+
+	// a new desired state resets the attempts and clears the pending retries
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]")
+	expectRecords(t, registry, "mohotani", map[string]state.Record{
+		"www.example.com":  {IPs: []string{"203.0.113.2"}, Owner: "mohotani"},
+		"www2.example.com": {IPs: []string{"203.0.113.2"}, Owner: "mohotani"},
+	})
+}
+
+func TestUpdaterPruneDelay(t *testing.T) {
+	registry := newTestRegistry(t, map[string]state.Record{
+		"old.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+	})
+	p := &removableUpdater{&flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}}
+	u := Updater{
+		Updater:    p,
+		Logger:     logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		State:      registry,
+		Provider:   "gandi",
+		Owner:      "mohotani",
+		Prune:      true,
+		PruneDelay: 200 * time.Millisecond,
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	// a domain missing from a list is not removed when listed again within the delay
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]")
+	domainListenerChannel <- []string{"www.example.com", "old.example.com"}
+	expectCalls(t, p.calls, "old.example.com=[203.0.113.1]")
+	time.Sleep(300 * time.Millisecond)
+	expectCalls(t, p.calls)
+
+	// it is removed once unlisted for the delay
+	start := time.Now()
+	domainListenerChannel <- []string{"www.example.com"}
+	expectCalls(t, p.calls, "remove old.example.com=[203.0.113.1]")
+	assert.True(t, time.Since(start) >= 200*time.Millisecond, "the records were removed before the delay")
+	expectRecords(t, registry, "mohotani", map[string]state.Record{
+		"www.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+	})
+}
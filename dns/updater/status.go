@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// heartbeatInterval is the interval at which the Start loop beats while idle
+	heartbeatInterval = time.Second
+	// heartbeatTimeout is the time after which a Start loop that did not beat is considered stuck
+	heartbeatTimeout = 30 * time.Second
+)
+
+// Status is a snapshot of the state of a running updater
+type Status struct {
+	// IPs and Domains are the last lists received from the listeners, nil until received
+	IPs     []string `json:"ips"`
+	Domains []string `json:"domains"`
+	// Failures are the errors of the domains whose last update failed
+	Failures       map[string]string `json:"failures,omitempty"`
+	PendingRetries int               `json:"pendingRetries"`
+	// Reconciled is true when the records of all domains are up to date, with no pending update
+	Reconciled bool `json:"reconciled"`
+}
+
+// Ready returns an error unless both the IPs and the domains were received, and the last update of each domain succeeded
+func (s Status) Ready() error {
+	if s.IPs == nil {
+		return fmt.Errorf("no IP received yet")
+	}
+	if s.Domains == nil {
+		return fmt.Errorf("no domain received yet")
+	}
+	if len(s.Failures) > 0 {
+		failed := []string{}
+		for domain := range s.Failures {
+			failed = append(failed, domain)
+		}
+		sort.Strings(failed)
+		return fmt.Errorf("failed to update domains [%s]", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Status returns the status of the running updater.
+// It is answered by the Start loop, so it fails when the updater is not running
+// or when the loop does not answer before ctx is done
+func (u *Updater) Status(ctx context.Context) (Status, error) {
+	u.lock.Lock()
+	statuses := u.statuses
+	u.lock.Unlock()
+	if statuses == nil {
+		return Status{}, fmt.Errorf("the updater is not running")
+	}
+	reply := make(chan Status, 1)
+	select {
+	case statuses <- reply:
+	case <-ctx.Done():
+		return Status{}, errors.Wrap(ctx.Err(), "the updater event loop is not responding")
+	}
+	select {
+	case status := <-reply:
+		return status, nil
+	case <-ctx.Done():
+		return Status{}, errors.Wrap(ctx.Err(), "the updater event loop is not responding")
+	}
+}
+
+// Started returns a channel closed once Start runs, from when Status and Alive answer
+func (u *Updater) Started() <-chan struct{} {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.started == nil {
+		u.started = make(chan struct{})
+	}
+	return u.started
+}
+
+// Alive returns an error when the updater is not running, or when the Start loop did not run for heartbeatTimeout.
+// Unlike Status, it does not wait for the loop and answers right away while the loop is busy
+func (u *Updater) Alive() error {
+	return u.alive(time.Now())
+}
+
+// alive returns an error when the updater is not running, or when the Start loop last ran more than heartbeatTimeout before now
+func (u *Updater) alive(now time.Time) error {
+	beat, _ := u.heartbeat.Load().(time.Time)
+	if beat.IsZero() {
+		return fmt.Errorf("the updater is not running")
+	}
+	if stale := now.Sub(beat); stale > heartbeatTimeout {
+		return fmt.Errorf("the updater event loop is stuck, it last ran %s ago", stale.Round(time.Second))
+	}
+	return nil
+}
+
+// status returns the current status of the updater, given the last lists received from the listeners
+func (u *Updater) status(IPs, domains []string) Status {
+	status := Status{
+		IPs:            IPs,
+		Domains:        domains,
+		PendingRetries: u.PendingRetries(),
+		Reconciled:     u.reconciled(),
+	}
+	if len(u.failures) > 0 {
+		status.Failures = map[string]string{}
+		for domain, err := range u.failures {
+			status.Failures[domain] = err.Error()
+		}
+	}
+	return status
+}
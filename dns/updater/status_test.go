@@ -0,0 +1,101 @@
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/state"
+)
+
+// expectStatus waits for the status of u to match expected
+func expectStatus(t *testing.T, u *Updater, expected Status) {
+	t.Helper()
+	var status Status
+	var err error
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		status, err = u.Status(ctx)
+		cancel()
+		if err == nil && assert.ObjectsAreEqual(expected, status) {
+			return
+		}
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, expected, status)
+}
+
+func TestUpdaterStatus(t *testing.T) {
+	store := &memoryStore{}
+	registry, err := state.Open(context.Background(), store)
+	assert.NoError(t, err)
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	p.fail("www2.example.com", 1)
+	u := &Updater{
+		Updater:  p,
+		Logger:   logger.FromPrintf(&testLogger{messages: make(chan string, 100)}),
+		Retry:    &Backoff{Initial: time.Hour, Max: time.Hour, MaxAttempts: 10},
+		State:    registry,
+		Provider: "gandi",
+		Owner:    "mohotani",
+	}
+	_, err = u.Status(context.Background())
+	assert.EqualError(t, err, "the updater is not running")
+	assert.EqualError(t, u.Alive(), "the updater is not running")
+	started := u.Started()
+
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, u)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("timeout starting the updater")
+	}
+	assert.NoError(t, u.Alive())
+	assert.EqualError(t, u.alive(time.Now().Add(time.Minute)), "the updater event loop is stuck, it last ran 1m0s ago")
+
+	expectStatus(t, u, Status{})
+	assert.EqualError(t, Status{}.Ready(), "no IP received yet")
+	ipListenerChannel <- []string{"203.0.113.1"}
+	expectStatus(t, u, Status{IPs: []string{"203.0.113.1"}})
+	assert.EqualError(t, Status{IPs: []string{"203.0.113.1"}}.Ready(), "no domain received yet")
+
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+	failed := Status{
+		IPs:            []string{"203.0.113.1"},
+		Domains:        []string{"www.example.com", "www2.example.com"},
+		Failures:       map[string]string{"www2.example.com": "test error"},
+		PendingRetries: 1,
+	}
+	expectStatus(t, u, failed)
+	assert.EqualError(t, failed.Ready(), "failed to update domains [www2.example.com]")
+
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.2]", "www2.example.com=[203.0.113.2]")
+	reconciled := Status{
+		IPs:        []string{"203.0.113.2"},
+		Domains:    []string{"www.example.com", "www2.example.com"},
+		Reconciled: true,
+	}
+	expectStatus(t, u, reconciled)
+	assert.NoError(t, reconciled.Ready())
+
+	// the loop keeps running while the state is being saved
+	store.lock.Lock()
+	ipListenerChannel <- []string{"203.0.113.3"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.3]", "www2.example.com=[203.0.113.3]")
+	expectStatus(t, u, Status{
+		IPs:        []string{"203.0.113.3"},
+		Domains:    []string{"www.example.com", "www2.example.com"},
+		Reconciled: true,
+	})
+	store.lock.Unlock()
+
+	stop()
+	_, err = u.Status(context.Background())
+	assert.EqualError(t, err, "the updater is not running")
+	assert.EqualError(t, u.Alive(), "the updater is not running")
+}
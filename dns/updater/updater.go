@@ -1,11 +1,22 @@
 package updater
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
 
 	"github.com/tjamet/mohotani/dns/provider"
+	"github.com/tjamet/mohotani/journal"
 	"github.com/tjamet/mohotani/listener"
 	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/notify"
+	"github.com/tjamet/mohotani/state"
 )
 
 // Updater his the structure holding the setup for automatic dns records update
@@ -14,35 +25,634 @@ type Updater struct {
 	IPListener     listener.Listener
 	DomainListener listener.Listener
 	Logger         logger.Logger
+	// Timeout is the maximum duration of a single provider update, no timeout is applied when zero
+	Timeout time.Duration
+	// ShutdownTimeout is the time left to in-flight provider updates to complete once the updater is stopped,
+	// they are cancelled right away when zero
+	ShutdownTimeout time.Duration
+	// Abort cancels the in-flight provider updates right away when closed once the updater is stopped,
+	// instead of waiting for ShutdownTimeout
+	Abort <-chan struct{}
+	// Retry is the backoff of the retries of failed updates, failed updates are not retried when nil
+	Retry *Backoff
+	// MinInterval is the minimum interval between two updates of the records of a domain with new IPs.
+	// The updates of IP changes are held until it elapsed, newer changes replacing the held ones
+	MinInterval time.Duration
+	// Resync is the channel triggering the repair of the records that differ from the desired state
+	// (typically fed by time.NewTicker(1 * time.Hour)). It requires Updater to implement provider.Reader
+	Resync <-chan time.Time
+	// Concurrency is the maximum number of provider calls in flight, defaults to 1
+	Concurrency int
+	// Limiter limits the rate of provider calls, no limit is applied when nil.
+	// It should be shared by all the updaters of a provider
+	Limiter *rate.Limiter
+	// State persists the applied records and pending retries, so they survive restarts. Nothing is persisted when nil
+	State *state.Registry
+	// Provider is the name of the DNS provider in State and metrics
+	Provider string
+	// Owner identifies the records of the updater in State and its metrics, updaters sharing a provider must have different owners
+	Owner string
+	// Prune removes the records of the domains that are no longer listed, including the ones removed while stopped.
+	// It requires State and Updater to implement provider.Remover
+	Prune bool
+	// PruneDelay is the duration a domain must stay unlisted before its records are removed,
+	// so that a partial list of domains does not remove the records of the missing ones
+	PruneDelay time.Duration
+	// Notifier is notified of IP changes, added and removed domains, failed updates and recoveries in the background.
+	// Each notification is limited to Timeout, nothing is notified when nil
+	Notifier notify.Notifier
+	// Journal records the changes applied to the records with their cause, nothing is recorded when nil
+	Journal *journal.Journal
+
+	// lock protects retries and statuses, the other fields are only used by the Start loop
+	lock     sync.Mutex
+	retries  map[string]*retry
+	failures map[string]error
+	applied  map[string][]string
+	// records are the values last applied to the records of each domain, they are kept when an update fails
+	records  map[string][]string
+	desired  map[string][]string
+	inflight map[string]bool
+	queued   map[string]*job
+	queue    []string
+	restored map[string]state.Retry
+	// changed are the times of the last updates of each domain with new IPs
+	changed map[string]time.Time
+	// holds are the IP changes held until MinInterval elapsed, by domain
+	holds map[string]*hold
+	// unlisted are the times domains of State were first seen unlisted, until their records are removed
+	unlisted map[string]time.Time
+	// pruning triggers the removal of the records of the domains unlisted for PruneDelay
+	pruning *time.Timer
+	// published are the IPs exposed in metrics
+	published []string
+	// progressed is set when a change or a provider call may have reconciled the records
+	progressed bool
+	// statuses receives the requests of the status of the updater, while running
+	statuses chan chan Status
+	// started is closed once Start runs, it is replaced when the updater stops
+	started chan struct{}
+	// heartbeat is the time of the last iteration of the Start loop, the zero time when stopped
+	heartbeat atomic.Value
+	// log is Logger with the provider and owner of the updater as fields
+	log logger.Logger
+	// events are the events waiting to be sent to Notifier
+	events chan notify.Event
+}
+
+// desire records IPs as the desired state of all domains and queues the updates of the ones that changed.
+// Pending retries of these domains are dropped, IP changes are held until released when MinInterval did not elapse
+func (u *Updater) desire(release chan<- *hold, stopped <-chan struct{}, domains, IPs []string) {
+	if domains == nil || IPs == nil {
+		return
+	}
+	for _, domain := range domains {
+		cause := journal.IPChanged
+		_, listed := u.desired[domain]
+		_, restored := u.restored[domain]
+		if _, ok := u.applied[domain]; !listed && !restored && !ok {
+			cause = journal.DomainAdded
+		}
+		u.desired[domain] = IPs
+		if applied, ok := u.applied[domain]; ok && sameValues(applied, IPs) {
+			continue
+		}
+		u.lock.Lock()
+		u.cancelRetry(domain)
+		u.lock.Unlock()
+		if cause == journal.IPChanged && u.hold(release, stopped, domain) {
+			continue
+		}
+		attempt := 0
+		if retry, ok := u.restored[domain]; ok && sameValues(retry.IPs, IPs) {
+			attempt = retry.Attempt + 1
+		}
+		delete(u.restored, domain)
+		u.enqueue(job{domain: domain, attempt: attempt, cause: cause})
+	}
+	u.forget(domains)
+	u.prune(domains)
+	u.progressed = true
+}
+
+// hold is an IP change held until MinInterval elapsed since the last update of its domain with new IPs
+type hold struct {
+	domain string
+	timer  *time.Timer
+}
+
+// hold delays the update of domain until MinInterval elapsed since its last update with new IPs.
+// The hold is sent to release once it elapsed, it returns whether the update is held
+func (u *Updater) hold(release chan<- *hold, stopped <-chan struct{}, domain string) bool {
+	if _, held := u.holds[domain]; held {
+		return true
+	}
+	changed, ok := u.changed[domain]
+	if !ok || u.MinInterval <= 0 {
+		return false
+	}
+	delay := u.MinInterval - time.Since(changed)
+	if delay <= 0 {
+		return false
+	}
+	u.log.Info("holding the IP change until the minimum interval elapsed", logger.Domain(domain), logger.F("delay", delay))
+	h := &hold{domain: domain}
+	h.timer = time.AfterFunc(delay, func() {
+		select {
+		case release <- h:
+		case <-stopped:
+		}
+	})
+	u.holds[domain] = h
+	return true
+}
+
+// unhold drops the hold of domain
+func (u *Updater) unhold(domain string) {
+	if h, held := u.holds[domain]; held {
+		h.timer.Stop()
+		delete(u.holds, domain)
+	}
+}
+
+// enqueue queues j unless its domain is already queued.
+// An update or a removal supersedes a queued job, a new desired state resets the retry attempts.
+// The first cause is kept while the queued job still updates the domain, the addition of a domain is not an IP change
+func (u *Updater) enqueue(j job) {
+	if queued, ok := u.queued[j.domain]; ok {
+		if !j.resync {
+			if queued.resync || queued.remove != j.remove {
+				queued.cause = j.cause
+			}
+			queued.resync = false
+			queued.remove = j.remove
+			queued.attempt = j.attempt
+			queued.previous = j.previous
+		}
+		return
+	}
+	u.queued[j.domain] = &j
+	u.queue = append(u.queue, j.domain)
+}
+
+// next returns the index of the first queued job that can be dispatched, with the desired IPs of its domain.
+// Updates of domains that are no longer listed or already up to date are dropped, as well as removals of listed domains.
+// Jobs of domains with an update in flight wait for its completion
+func (u *Updater) next() (int, job, bool) {
+	for i := 0; i < len(u.queue); {
+		domain := u.queue[i]
+		j := u.queued[domain]
+		IPs, listed := u.desired[domain]
+		applied, ok := u.applied[domain]
+		if listed == j.remove || (!j.remove && !j.resync && ok && sameValues(applied, IPs)) {
+			u.unqueue(i)
+			continue
+		}
+		if u.inflight[domain] {
+			i++
+			continue
+		}
+		if !j.remove {
+			j.IPs = IPs
+			j.previous = u.records[domain]
+		}
+		return i, *j, true
+	}
+	return 0, job{}, false
+}
+
+func (u *Updater) unqueue(i int) {
+	delete(u.queued, u.queue[i])
+	u.queue = append(u.queue[:i], u.queue[i+1:]...)
+}
+
+// done records the result of a job.
+// Failed updates are retried according to Retry unless a newer desired state is already queued
+func (u *Updater) done(ctx context.Context, due chan<- *retry, stopped <-chan struct{}, r result) {
+	delete(u.inflight, r.domain)
+	u.progressed = true
+	if !r.updated {
+		return
+	}
+	if r.remove {
+		if r.err != nil {
+			u.log.Error("failed to remove records", logger.Domain(r.domain), logger.Err(r.err))
+			return
+		}
+		u.log.Info("removed records", logger.Domain(r.domain))
+		delete(u.records, r.domain)
+		u.save(r.domain, nil)
+		u.record(r)
+		return
+	}
+	if r.err != nil {
+		u.log.Error("failed to update records", logger.Domain(r.domain), logger.IPs(r.IPs), logger.Err(r.err))
+		if _, failing := u.failures[r.domain]; !failing {
+			u.notify(notify.Event{Kind: notify.UpdateFailed, Domain: r.domain, IPs: r.IPs, Error: r.err.Error(), Attempt: r.attempt})
+		}
+		u.failures[r.domain] = r.err
+		u.save(r.domain, &state.Record{IPs: u.records[r.domain], Retry: &state.Retry{IPs: r.IPs, Attempt: r.attempt, Error: r.err.Error()}})
+		delete(u.applied, r.domain)
+		if _, queued := u.queued[r.domain]; queued || u.Retry == nil || ctx.Err() != nil {
+			return
+		}
+		if !u.schedule(due, stopped, r.domain, r.attempt, r.cause) {
+			u.log.Error("giving up updating records", logger.Domain(r.domain), logger.F("retries", r.attempt))
+		}
+		return
+	}
+	u.log.Info("updated records", logger.Domain(r.domain), logger.IPs(r.IPs))
+	if _, failing := u.failures[r.domain]; failing {
+		u.notify(notify.Event{Kind: notify.Recovered, Domain: r.domain, IPs: r.IPs, Attempt: r.attempt})
+	}
+	delete(u.failures, r.domain)
+	if r.cause != journal.Drift {
+		u.changed[r.domain] = time.Now()
+	}
+	u.applied[r.domain] = r.IPs
+	u.records[r.domain] = r.IPs
+	u.save(r.domain, &state.Record{IPs: r.IPs, Updated: time.Now()})
+	u.record(r)
+}
+
+// restore loads the applied records and the pending retries from State
+func (u *Updater) restore() {
+	u.restored = map[string]state.Retry{}
+	if u.State == nil {
+		return
+	}
+	for domain, record := range u.State.Records(u.Provider, u.Owner) {
+		if len(record.IPs) > 0 {
+			u.records[domain] = record.IPs
+		}
+		if record.Retry != nil {
+			u.restored[domain] = *record.Retry
+		} else {
+			u.applied[domain] = record.IPs
+		}
+	}
+}
+
+// save records the state of the records of domain in State, the domain is forgotten when record is nil.
+// State persists it in the background
+func (u *Updater) save(domain string, record *state.Record) {
+	if u.State == nil {
+		return
+	}
+	if record == nil {
+		u.State.Delete(u.Provider, domain)
+		return
+	}
+	record.Owner = u.Owner
+	u.State.Set(u.Provider, domain, *record)
+}
+
+// flush waits for State to persist the changes, for up to ShutdownTimeout when set
+func (u *Updater) flush() {
+	if u.State == nil {
+		return
+	}
+	ctx := context.Background()
+	if u.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := u.State.Flush(ctx); err != nil {
+		u.log.Error("failed to save the state of the records", logger.Err(err))
+	}
+}
+
+// prune handles the domains of State that are no longer listed, including the ones removed while stopped.
+// Their records are removed when Prune is set and they stayed unlisted for PruneDelay, and left in place otherwise
+func (u *Updater) prune(domains []string) {
+	if u.State == nil {
+		return
+	}
+	listed := map[string]bool{}
+	for _, domain := range domains {
+		listed[domain] = true
+	}
+	for domain := range u.unlisted {
+		if listed[domain] {
+			delete(u.unlisted, domain)
+		}
+	}
+	_, removable := u.Updater.(provider.Remover)
+	now := time.Now()
+	var next time.Duration
+	for domain, record := range u.State.Records(u.Provider, u.Owner) {
+		if listed[domain] || u.inflight[domain] {
+			continue
+		}
+		if u.Prune && removable {
+			since, ok := u.unlisted[domain]
+			if !ok {
+				since = now
+				u.unlisted[domain] = now
+			}
+			if delay := u.PruneDelay - now.Sub(since); delay > 0 {
+				if !ok {
+					u.log.Info("domain is no longer listed, its records will be removed unless it is listed again", logger.Domain(domain), logger.F("delay", delay))
+				}
+				if next == 0 || delay < next {
+					next = delay
+				}
+				continue
+			}
+			delete(u.unlisted, domain)
+			u.enqueue(job{domain: domain, remove: true, cause: journal.DomainRemoved, previous: record.IPs})
+			continue
+		}
+		u.log.Info("domain is no longer listed, its records are left in place", logger.Domain(domain))
+		u.save(domain, nil)
+	}
+	if u.pruning != nil {
+		u.pruning.Stop()
+		u.pruning = nil
+	}
+	if next > 0 {
+		u.pruning = time.NewTimer(next)
+	}
+}
+
+// resync queues the check of the records of all domains.
+// Domains with a pending update or retry are left to it
+func (u *Updater) resync() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for domain := range u.desired {
+		if _, pending := u.retries[domain]; pending || u.inflight[domain] {
+			continue
+		}
+		u.enqueue(job{domain: domain, resync: true, cause: journal.Drift})
+	}
+}
+
+// drifted returns whether the actual records differ from the desired ones.
+// Only the IPv4 or IPv6 records with desired values are compared, as they are the only ones updated
+func drifted(desired, actual []string) bool {
+	desired4, desired6 := provider.SplitIPs(desired)
+	actual4, actual6 := provider.SplitIPs(actual)
+	return (len(desired4) > 0 && !sameValues(desired4, actual4)) || (len(desired6) > 0 && !sameValues(desired6, actual6))
 }
 
-func (u *Updater) apply(domains, IPs []string) {
-	if domains != nil && IPs != nil {
-		for _, domain := range domains {
-			err := u.Updater.Update(domain, IPs...)
-			if err != nil {
-				u.Logger.Printf("failed to update domain %s: %s", domain, err)
-			} else {
-				u.Logger.Printf("updated domain %s with IPs %s", domain, strings.Join(IPs, ","))
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// forget drops the desired and applied states, failures and pending retries of the domains that are no longer listed
+func (u *Updater) forget(domains []string) {
+	listed := map[string]bool{}
+	for _, domain := range domains {
+		listed[domain] = true
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for domain := range u.retries {
+		if !listed[domain] {
+			u.cancelRetry(domain)
+		}
+	}
+	for _, states := range []map[string][]string{u.desired, u.applied, u.records} {
+		for domain := range states {
+			if !listed[domain] {
+				delete(states, domain)
 			}
 		}
 	}
+	for domain := range u.failures {
+		if !listed[domain] {
+			delete(u.failures, domain)
+		}
+	}
+	for domain := range u.changed {
+		if !listed[domain] {
+			delete(u.changed, domain)
+		}
+	}
+	for domain := range u.holds {
+		if !listed[domain] {
+			u.unhold(domain)
+		}
+	}
+}
+
+// waiting returns the domains whose queued or held update was not dispatched
+func (u *Updater) waiting() []string {
+	domains := []string{}
+	for domain := range u.holds {
+		domains = append(domains, domain)
+	}
+	for domain, j := range u.queued {
+		IPs, listed := u.desired[domain]
+		applied, ok := u.applied[domain]
+		if listed && !j.resync && !(ok && sameValues(applied, IPs)) {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// err returns the error reflecting the current state of the records, if any
+func (u *Updater) err(interrupted []string) error {
+	messages := []string{}
+	if len(u.failures) > 0 {
+		failed := []string{}
+		for domain := range u.failures {
+			failed = append(failed, domain)
+		}
+		sort.Strings(failed)
+		messages = append(messages, fmt.Sprintf("failed to update domains [%s]", strings.Join(failed, ", ")))
+	}
+	if len(interrupted) > 0 {
+		messages = append(messages, fmt.Sprintf("reconciliation interrupted, domains [%s] were not updated", strings.Join(interrupted, ", ")))
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(messages, ", "))
 }
 
 // Start applies the record registry updates in case of any change in either the IP or the domains
-func (u *Updater) Start() {
+// until ctx is done.
+// Provider calls are run by Concurrency workers, while newer desired states are coalesced.
+// Failed updates are retried in the background according to Retry, records are repaired at each Resync tick.
+// In-flight provider updates are given ShutdownTimeout to complete once ctx is done, unless Abort is closed.
+// The applied records and pending retries are restored from State, and persisted in it. Applied changes are recorded in Journal.
+// The state of the updater is exposed in metrics and by Status while it runs, its changes are sent to Notifier.
+// Pending notifications are given ShutdownTimeout to be sent once ctx is done.
+// It returns an error when the records of some domains are not up to date
+func (u *Updater) Start(ctx context.Context) error {
+	updateCtx, cancelUpdates := context.WithCancel(context.Background())
+	defer cancelUpdates()
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+		select {
+		case <-time.After(u.ShutdownTimeout):
+			cancelUpdates()
+		case <-u.Abort:
+			cancelUpdates()
+		case <-stopped:
+		}
+	}()
+
+	u.lock.Lock()
+	u.retries = map[string]*retry{}
+	u.failures = map[string]error{}
+	u.applied = map[string][]string{}
+	u.records = map[string][]string{}
+	u.desired = map[string][]string{}
+	u.inflight = map[string]bool{}
+	u.queued = map[string]*job{}
+	u.queue = []string{}
+	u.changed = map[string]time.Time{}
+	u.holds = map[string]*hold{}
+	u.unlisted = map[string]time.Time{}
+	u.statuses = make(chan chan Status)
+	u.heartbeat.Store(time.Now())
+	if u.started == nil {
+		u.started = make(chan struct{})
+	}
+	close(u.started)
+	u.lock.Unlock()
+	defer func() {
+		u.lock.Lock()
+		u.statuses = nil
+		u.started = nil
+		u.heartbeat.Store(time.Time{})
+		u.lock.Unlock()
+	}()
+	u.log = u.Logger
+	if u.Provider != "" {
+		u.log = logger.With(u.log, logger.Provider(u.Provider))
+	}
+	if u.Owner != "" {
+		u.log = logger.With(u.log, logger.F("owner", u.Owner))
+	}
+	u.restore()
+	defer u.flush()
+	defer u.forget(nil)
+	defer u.unobserve()
+
+	resync := u.Resync
+	reader, ok := u.Updater.(provider.Reader)
+	if resync != nil && !ok {
+		u.log.Warn("the DNS provider can not read records, resync is disabled")
+		resync = nil
+	}
+	if _, ok := u.Updater.(provider.Remover); u.Prune && !ok {
+		u.log.Warn("the DNS provider can not remove records, records of domains that are no longer listed are left in place")
+	}
+
+	if u.Notifier != nil {
+		u.events = make(chan notify.Event, notifications)
+		delivered := make(chan struct{})
+		go func() {
+			defer close(delivered)
+			u.deliver(updateCtx, u.events)
+		}()
+		defer func() {
+			close(u.events)
+			<-delivered
+		}()
+	}
+
+	jobs := make(chan job)
+	defer close(jobs)
+	results := make(chan result)
+	workers := u.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go u.work(updateCtx, reader, jobs, results)
+	}
+
 	ipsChannel := make(chan []string)
 	domainsChannel := make(chan []string)
+	due := make(chan *retry)
+	release := make(chan *hold)
+	statuses := u.statuses
 	var IPs []string
 	var domains []string
-	go u.IPListener.Listen(ipsChannel)
-	go u.DomainListener.Listen(domainsChannel)
+	go u.IPListener.Listen(ctx, ipsChannel)
+	go u.DomainListener.Listen(ctx, domainsChannel)
+	defer func() {
+		if u.pruning != nil {
+			u.pruning.Stop()
+		}
+	}()
+	beats := time.NewTicker(heartbeatInterval)
+	defer beats.Stop()
 	for {
+		u.heartbeat.Store(time.Now())
+		var dispatch chan<- job
+		var pruned <-chan time.Time
+		if u.pruning != nil {
+			pruned = u.pruning.C
+		}
+		i, next, ok := u.next()
+		if ok {
+			dispatch = jobs
+		}
+		u.observe()
 		select {
-		case IPs = <-ipsChannel:
-			u.apply(domains, IPs)
-		case domains = <-domainsChannel:
-			u.apply(domains, IPs)
+		case ips := <-ipsChannel:
+			u.notifyIPs(IPs, ips)
+			IPs = ips
+			u.publish(IPs)
+			u.desire(release, stopped, domains, IPs)
+		case list := <-domainsChannel:
+			u.notifyDomains(domains, list)
+			domains = list
+			u.desire(release, stopped, domains, IPs)
+		case r := <-due:
+			if u.current(r) {
+				u.enqueue(job{domain: r.domain, attempt: r.attempt, cause: r.cause})
+			}
+		case h := <-release:
+			if u.holds[h.domain] == h {
+				delete(u.holds, h.domain)
+				u.enqueue(job{domain: h.domain, cause: journal.IPChanged})
+			}
+		case <-pruned:
+			u.pruning = nil
+			u.prune(domains)
+		case <-resync:
+			u.resync()
+		case dispatch <- next:
+			u.unqueue(i)
+			u.inflight[next.domain] = true
+		case r := <-results:
+			u.done(ctx, due, stopped, r)
+		case reply := <-statuses:
+			reply <- u.status(IPs, domains)
+		case <-beats.C:
+		case <-ctx.Done():
+			for len(u.inflight) > 0 {
+				u.done(ctx, due, stopped, <-results)
+			}
+			return u.err(u.waiting())
 		}
 	}
 }
@@ -1,13 +1,16 @@
 package updater
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/journal"
+	"github.com/tjamet/mohotani/logger"
 )
 
 type testUpdater struct {
@@ -16,7 +19,7 @@ type testUpdater struct {
 	err     chan error
 }
 
-func (t *testUpdater) Update(domain string, ips ...string) error {
+func (t *testUpdater) Update(ctx context.Context, domain string, ips ...string) error {
 	t.domains <- domain
 	t.ips <- ips
 	return <-t.err
@@ -50,14 +53,51 @@ type testListener struct {
 	c chan chan []string
 }
 
-func (l *testListener) Listen(c chan []string) {
+func (l *testListener) Listen(ctx context.Context, c chan []string) {
 	l.c <- c
 }
 
+// startUpdater starts u with test listeners and returns the channels of its IP and domain listeners.
+// stop cancels the context of u and returns the error returned by Start
+func startUpdater(t *testing.T, u *Updater) (chan []string, chan []string, func() error) {
+	ipL := &testListener{
+		c: make(chan chan []string),
+	}
+	dL := &testListener{
+		c: make(chan chan []string),
+	}
+	u.IPListener = ipL
+	u.DomainListener = dL
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- u.Start(ctx)
+	}()
+	ipListenerChannel := <-ipL.c
+	domainListenerChannel := <-dL.c
+	stop := func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(3 * time.Second):
+			t.Error("Start did not return after its context was cancelled")
+			return nil
+		}
+	}
+	return ipListenerChannel, domainListenerChannel, stop
+}
+
 func TestUpdater(t *testing.T) {
 	failed := make(chan interface{})
+	completed := make(chan struct{})
+	defer close(completed)
 	go func() {
-		<-time.After(3 * time.Second)
+		select {
+		case <-time.After(3 * time.Second):
+		case <-completed:
+			return
+		}
 		t.Error("timeout executing the test")
 		for {
 			failed <- nil
@@ -68,25 +108,15 @@ func TestUpdater(t *testing.T) {
 		ips:     make(chan []string, 10),
 		err:     make(chan error, 10),
 	}
-	ipL := &testListener{
-		c: make(chan chan []string),
-	}
-	dL := &testListener{
-		c: make(chan chan []string),
-	}
 	u := Updater{
-		Updater:        ipU,
-		IPListener:     ipL,
-		DomainListener: dL,
-		Logger:         log.New(os.Stdout, "test logger: ", log.LstdFlags),
+		Updater: ipU,
+		Logger:  logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
 	}
-	go u.Start()
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
 	assert.Equal(t, []string{}, ipU.getDomains())
 	assert.Equal(t, [][]string{}, ipU.getIPs())
 
-	ipListenerChannel := <-ipL.c
-	domainListenerChannel := <-dL.c
-
 	ipU.err <- nil
 	select {
 	case ipListenerChannel <- []string{"127.0.0.1"}:
@@ -123,22 +153,212 @@ func TestUpdater(t *testing.T) {
 	assert.Equal(t, []string{"www.example.com"}, ipU.getDomains())
 	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.1"}}, ipU.getIPs())
 
+	// unchanged IPs are not sent again
+	select {
+	case ipListenerChannel <- []string{"10.2.0.1", "127.0.0.1"}:
+	case <-failed:
+		t.Errorf("Failed to notify IP listeners")
+	}
+	assert.Equal(t, []string{}, ipU.getDomains())
+	assert.Equal(t, [][]string{}, ipU.getIPs())
+
+	// drop the errors queued for updates that did not happen
+	for len(ipU.err) > 0 {
+		<-ipU.err
+	}
 	ipU.err <- fmt.Errorf("test error")
 	select {
-	case ipListenerChannel <- []string{"127.0.0.1", "10.2.0.1"}:
+	case ipListenerChannel <- []string{"127.0.0.1", "10.2.0.2"}:
 	case <-failed:
 		t.Errorf("Failed to notify IP listeners")
 	}
 	assert.Equal(t, []string{"www.example.com"}, ipU.getDomains())
-	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.1"}}, ipU.getIPs())
+	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.2"}}, ipU.getIPs())
 
 	// can recover from errors
 	ipU.err <- nil
+	ipU.err <- nil
 	select {
 	case domainListenerChannel <- []string{"www.example.com", "www2.example.com"}:
 	case <-failed:
 		t.Errorf("Failed to notify Domain listeners")
 	}
 	assert.Equal(t, []string{"www.example.com", "www2.example.com"}, ipU.getDomains())
-	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.1"}, {"127.0.0.1", "10.2.0.1"}}, ipU.getIPs())
+	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.2"}, {"127.0.0.1", "10.2.0.2"}}, ipU.getIPs())
+
+	// only added domains are sent
+	ipU.err <- nil
+	select {
+	case domainListenerChannel <- []string{"www.example.com", "www2.example.com", "www3.example.com"}:
+	case <-failed:
+		t.Errorf("Failed to notify Domain listeners")
+	}
+	assert.Equal(t, []string{"www3.example.com"}, ipU.getDomains())
+	assert.Equal(t, [][]string{{"127.0.0.1", "10.2.0.2"}}, ipU.getIPs())
+
+	// removed and added again domains are sent again
+	select {
+	case domainListenerChannel <- []string{"www.example.com", "www3.example.com"}:
+	case <-failed:
+		t.Errorf("Failed to notify Domain listeners")
+	}
+	assert.Equal(t, []string{}, ipU.getDomains())
+	ipU.err <- nil
+	select {
+	case domainListenerChannel <- []string{"www.example.com", "www2.example.com", "www3.example.com"}:
+	case <-failed:
+		t.Errorf("Failed to notify Domain listeners")
+	}
+	assert.Equal(t, []string{"www2.example.com"}, ipU.getDomains())
+}
+
+type blockingUpdater struct{}
+
+func (blockingUpdater) Update(ctx context.Context, domain string, ips ...string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestUpdaterTimeoutAndCancel(t *testing.T) {
+	u := Updater{
+		Updater: blockingUpdater{},
+		Logger:  logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+		Timeout: 10 * time.Millisecond,
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	ipListenerChannel <- []string{"127.0.0.1"}
+	domainListenerChannel <- []string{"www.example.com"}
+
+	// the blocked update times out and the updater keeps processing changes
+	select {
+	case ipListenerChannel <- []string{"10.2.0.1"}:
+	case <-time.After(3 * time.Second):
+		t.Error("the updater is stuck on a provider call")
+	}
+
+	err := stop()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "www.example.com")
+}
+
+type releasedUpdater struct {
+	started  chan struct{}
+	release  chan struct{}
+	canceled chan error
+}
+
+func (r *releasedUpdater) Update(ctx context.Context, domain string, ips ...string) error {
+	r.started <- struct{}{}
+	select {
+	case <-r.release:
+		return nil
+	case <-ctx.Done():
+		r.canceled <- ctx.Err()
+		return ctx.Err()
+	}
+}
+
+func TestUpdaterShutdown(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		domains         []string
+		shutdownTimeout time.Duration
+		abort           bool
+		release         bool
+		err             string
+	}{
+		{name: "in-flight update completes", domains: []string{"www.example.com"}, shutdownTimeout: 3 * time.Second, release: true},
+		{name: "pending updates are interrupted", domains: []string{"www.example.com", "www2.example.com"}, shutdownTimeout: 3 * time.Second, release: true, err: "domains [www2.example.com] were not updated"},
+		{name: "in-flight update exceeds the deadline", domains: []string{"www.example.com"}, shutdownTimeout: 10 * time.Millisecond, err: "failed to update domains [www.example.com]"},
+		{name: "in-flight update is cancelled right away", domains: []string{"www.example.com"}, err: "failed to update domains [www.example.com]"},
+		{name: "in-flight update is aborted", domains: []string{"www.example.com"}, shutdownTimeout: 3 * time.Second, abort: true, err: "failed to update domains [www.example.com]"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := &releasedUpdater{
+				started:  make(chan struct{}, 10),
+				release:  make(chan struct{}),
+				canceled: make(chan error, 10),
+			}
+			abort := make(chan struct{})
+			if test.abort {
+				close(abort)
+			}
+			u := Updater{
+				Updater:         p,
+				Logger:          logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+				ShutdownTimeout: test.shutdownTimeout,
+				Abort:           abort,
+			}
+			ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+			ipListenerChannel <- []string{"127.0.0.1"}
+			domainListenerChannel <- test.domains
+			<-p.started
+
+			stopped := make(chan error, 1)
+			go func() {
+				stopped <- stop()
+			}()
+			if test.release {
+				select {
+				case err := <-p.canceled:
+					t.Errorf("the in-flight update was cancelled: %s", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+				close(p.release)
+			}
+			err := <-stopped
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+			}
+			assert.Equal(t, 0, len(p.started))
+		})
+	}
+}
+
+func TestUpdaterMinInterval(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	l := &testLogger{messages: make(chan string, 100)}
+	u := Updater{
+		Updater:     p,
+		Logger:      logger.FromPrintf(l),
+		MinInterval: 300 * time.Millisecond,
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	domainListenerChannel <- []string{"www.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1"}
+	start := time.Now()
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]")
+
+	// IP changes are held until the minimum interval since the last update of the domain elapsed,
+	// the interval of each domain is independent
+	ipListenerChannel <- []string{"203.0.113.2"}
+	ipListenerChannel <- []string{"203.0.113.3"}
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com"}
+	expectCalls(t, p.calls, "www2.example.com=[203.0.113.3]")
+	assert.NotEqual(t, "", l.find("holding the IP change until the minimum interval elapsed"))
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.3]")
+	assert.True(t, time.Since(start) >= 300*time.Millisecond, "the IP change was applied before the minimum interval")
+}
+
+func TestUpdaterEnqueue(t *testing.T) {
+	u := &Updater{queued: map[string]*job{}}
+	u.enqueue(job{domain: "www.example.com", cause: journal.DomainAdded})
+	u.enqueue(job{domain: "www.example.com", cause: journal.IPChanged})
+	u.enqueue(job{domain: "www.example.com", resync: true, cause: journal.Drift})
+	assert.Equal(t, []string{"www.example.com"}, u.queue)
+	assert.Equal(t, journal.DomainAdded, u.queued["www.example.com"].cause)
+
+	// a removal supersedes the queued update, and an update the removal or the repair
+	u.enqueue(job{domain: "www.example.com", remove: true, cause: journal.DomainRemoved})
+	assert.Equal(t, journal.DomainRemoved, u.queued["www.example.com"].cause)
+	u.enqueue(job{domain: "www.example.com", cause: journal.DomainAdded})
+	assert.Equal(t, journal.DomainAdded, u.queued["www.example.com"].cause)
+	u.enqueue(job{domain: "www2.example.com", resync: true, cause: journal.Drift})
+	u.enqueue(job{domain: "www2.example.com", cause: journal.IPChanged})
+	assert.Equal(t, journal.IPChanged, u.queued["www2.example.com"].cause)
 }
@@ -0,0 +1,138 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"github.com/tjamet/mohotani/dns/provider"
+	"github.com/tjamet/mohotani/journal"
+	"github.com/tjamet/mohotani/logger"
+)
+
+// job is an update of the records of a domain, run by a worker
+type job struct {
+	domain string
+	IPs    []string
+	// attempt is the number of retries of the update already failed
+	attempt int
+	// resync reads the records first, and only updates them when they drifted from IPs
+	resync bool
+	// remove removes the records of a domain that is no longer listed
+	remove bool
+	// cause is the event that caused the job, recorded in Journal
+	cause journal.Cause
+	// previous are the values last applied to the records of the domain. A removal removes them,
+	// an update removes the ones of the address families IPs has no value in
+	previous []string
+}
+
+// result is the outcome of a job
+type result struct {
+	job
+	err error
+	// updated is false when the job did not update the records
+	updated bool
+	// actual are the records read before repairing them on resync
+	actual []string
+}
+
+// work runs jobs until the jobs channel is closed, provider calls are made with ctx
+func (u *Updater) work(ctx context.Context, reader provider.Reader, jobs <-chan job, results chan<- result) {
+	for j := range jobs {
+		results <- u.run(ctx, reader, j)
+	}
+}
+
+func (u *Updater) run(ctx context.Context, reader provider.Reader, j job) result {
+	if j.remove {
+		return result{job: j, err: u.remove(ctx, j.domain, j.previous), updated: true}
+	}
+	var actual []string
+	if j.resync {
+		var err error
+		actual, err = u.get(ctx, reader, j.domain)
+		if err != nil {
+			u.log.Error("failed to read records", logger.Domain(j.domain), logger.Err(err))
+			return result{job: j}
+		}
+		if !drifted(j.IPs, actual) {
+			u.log.Debug("records are up to date", logger.Domain(j.domain), logger.IPs(j.IPs))
+			return result{job: j}
+		}
+		u.log.Warn("records drifted, restoring them", logger.Domain(j.domain), logger.F("records", actual), logger.IPs(j.IPs))
+	}
+	err := u.update(ctx, j.domain, j.IPs)
+	if err == nil {
+		err = u.clear(ctx, j)
+	}
+	return result{job: j, err: err, updated: true, actual: actual}
+}
+
+// clear removes the previous values of the address families that vanished from the records of the domain of j,
+// as they are left in place by the update
+func (u *Updater) clear(ctx context.Context, j job) error {
+	stale := provider.Vanished(j.previous, j.IPs)
+	if len(stale) == 0 {
+		return nil
+	}
+	if _, ok := u.Updater.(provider.Remover); !ok {
+		u.log.Warn("the DNS provider can not remove records, the records of the vanished address family are left in place", logger.Domain(j.domain), logger.F("records", stale))
+		return nil
+	}
+	return u.remove(ctx, j.domain, stale)
+}
+
+// wait blocks until Limiter allows a provider call
+func (u *Updater) wait(ctx context.Context) error {
+	if u.Limiter == nil {
+		return nil
+	}
+	return u.Limiter.Wait(ctx)
+}
+
+// call runs the provider operation on domain limited to Timeout, once Limiter allows it.
+// Its duration and failure are recorded in metrics
+func (u *Updater) call(ctx context.Context, operation, domain string, f func(context.Context) error) error {
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	if err := u.wait(ctx); err != nil {
+		return err
+	}
+	start := time.Now()
+	err := f(ctx)
+	callDuration.WithLabelValues(u.Provider, operation, domain).Observe(time.Since(start).Seconds())
+	if err != nil {
+		callErrors.WithLabelValues(u.Provider, operation, domain).Inc()
+	}
+	return err
+}
+
+func (u *Updater) update(ctx context.Context, domain string, IPs []string) error {
+	return u.call(ctx, "update", domain, func(ctx context.Context) error {
+		return u.Updater.Update(ctx, domain, IPs...)
+	})
+}
+
+// remove removes values from the records of domain, nothing is removed when no value is known
+func (u *Updater) remove(ctx context.Context, domain string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return u.call(ctx, "remove", domain, func(ctx context.Context) error {
+		return u.Updater.(provider.Remover).Remove(ctx, domain, values...)
+	})
+}
+
+// get reads the current records of domain
+func (u *Updater) get(ctx context.Context, reader provider.Reader, domain string) ([]string, error) {
+	var values []string
+	err := u.call(ctx, "get", domain, func(ctx context.Context) error {
+		var err error
+		values, err = reader.Get(ctx, domain)
+		return err
+	})
+	return values, err
+}
@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type gatedUpdater struct {
+	started chan string
+	release chan struct{}
+}
+
+func (g *gatedUpdater) Update(ctx context.Context, domain string, ips ...string) error {
+	g.started <- fmt.Sprintf("%s=%v", domain, ips)
+	<-g.release
+	return nil
+}
+
+func TestUpdaterConcurrency(t *testing.T) {
+	p := &gatedUpdater{started: make(chan string, 10), release: make(chan struct{})}
+	u := Updater{
+		Updater:     p,
+		Logger:      logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+		Concurrency: 2,
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com", "www3.example.com"}
+	// 2 updates run in parallel
+	expectCalls(t, p.started, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]")
+
+	// the listeners are not blocked by the updates in flight, and intermediate states are coalesced
+	for _, ip := range []string{"203.0.113.2", "203.0.113.3"} {
+		select {
+		case ipListenerChannel <- []string{ip}:
+		case <-time.After(3 * time.Second):
+			t.Fatal("the updater does not receive changes while updates are in flight")
+		}
+	}
+
+	close(p.release)
+	expectCalls(t, p.started, "www.example.com=[203.0.113.3]", "www2.example.com=[203.0.113.3]", "www3.example.com=[203.0.113.3]")
+}
+
+func TestUpdaterRateLimit(t *testing.T) {
+	p := &flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}
+	u := Updater{
+		Updater:     p,
+		Logger:      logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+		Concurrency: 3,
+		Limiter:     rate.NewLimiter(rate.Every(50*time.Millisecond), 1),
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	start := time.Now()
+	ipListenerChannel <- []string{"203.0.113.1"}
+	domainListenerChannel <- []string{"www.example.com", "www2.example.com", "www3.example.com"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]", "www3.example.com=[203.0.113.1]")
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestUpdaterVanishedFamily(t *testing.T) {
+	p := &removableUpdater{&flakyUpdater{failures: map[string]int{}, calls: make(chan string, 100)}}
+	u := Updater{
+		Updater: p,
+		Logger:  logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+	}
+	ipListenerChannel, domainListenerChannel, stop := startUpdater(t, &u)
+	defer stop()
+
+	domainListenerChannel <- []string{"www.example.com"}
+	ipListenerChannel <- []string{"203.0.113.1", "2001:db8::1"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.1 2001:db8::1]")
+
+	// the values of the family that vanished are removed, the other family is updated
+	ipListenerChannel <- []string{"203.0.113.2"}
+	expectCalls(t, p.calls, "www.example.com=[203.0.113.2]", "remove www.example.com=[2001:db8::1]")
+
+	ipListenerChannel <- []string{"2001:db8::2"}
+	expectCalls(t, p.calls, "www.example.com=[2001:db8::2]", "remove www.example.com=[203.0.113.2]")
+}
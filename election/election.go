@@ -0,0 +1,35 @@
+package election
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Elector elects a single leader among several instances
+type Elector interface {
+	// Run campaigns for the leadership until ctx is done, calling lead each time it is acquired.
+	// The context given to lead is cancelled when the leadership is lost,
+	// Run waits for lead to return before campaigning again.
+	// It returns an error when the election can not be run
+	Run(ctx context.Context, lead func(context.Context)) error
+	// IsLeader returns whether the instance currently leads
+	IsLeader() bool
+}
+
+// leadership holds whether an elector currently leads
+type leadership struct {
+	leading int32
+}
+
+func (l *leadership) set(leading bool) {
+	value := int32(0)
+	if leading {
+		value = 1
+	}
+	atomic.StoreInt32(&l.leading, value)
+}
+
+// IsLeader implements the Elector interface
+func (l *leadership) IsLeader() bool {
+	return atomic.LoadInt32(&l.leading) == 1
+}
@@ -0,0 +1,69 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+// File elects the leader holding an exclusive lock on a local file, for instances running on a single host.
+// The leader writes its identity in the file
+type File struct {
+	leadership
+	Path string
+	// Identity is the unique name of the instance among the candidates
+	Identity string
+	// RetryPeriod is the interval between attempts to acquire the lock
+	RetryPeriod time.Duration
+	Logger      logger.Logger
+}
+
+// Run implements the Elector interface.
+// The lock is only lost when the process exits, it is released when ctx is done
+func (f *File) Run(ctx context.Context, lead func(context.Context)) error {
+	file, err := os.OpenFile(f.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to open lock file %s", f.Path))
+	}
+	defer file.Close()
+	standby := false
+	for {
+		locked, err := lock(file)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to lock file %s", f.Path))
+		}
+		if locked {
+			break
+		}
+		if !standby {
+			leader, _ := ioutil.ReadFile(f.Path)
+			f.Logger.Info("standing by", logger.F("lock", f.Path), logger.F("identity", f.Identity), logger.F("leader", strings.TrimSpace(string(leader))))
+			standby = true
+		}
+		select {
+		case <-time.After(f.RetryPeriod):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	defer unlock(file)
+	if err := file.Truncate(0); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to write lock file %s", f.Path))
+	}
+	if _, err := file.WriteAt([]byte(f.Identity+"\n"), 0); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to write lock file %s", f.Path))
+	}
+	f.set(true)
+	f.Logger.Info("acquired the leadership", logger.F("lock", f.Path), logger.F("identity", f.Identity))
+	lead(ctx)
+	f.set(false)
+	f.Logger.Info("released the leadership", logger.F("lock", f.Path), logger.F("identity", f.Identity))
+	return nil
+}
@@ -0,0 +1,111 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type testLogger struct {
+	messages chan string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.messages <- fmt.Sprintf(format, v...)
+}
+
+// candidate runs e in the background, sending the state of its leadership on leading
+type candidate struct {
+	leading chan bool
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+func campaign(e Elector) *candidate {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &candidate{leading: make(chan bool, 10), cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		c.done <- e.Run(ctx, func(ctx context.Context) {
+			c.leading <- true
+			<-ctx.Done()
+			c.leading <- false
+		})
+	}()
+	return c
+}
+
+func (c *candidate) expect(t *testing.T, leading bool) {
+	select {
+	case l := <-c.leading:
+		assert.Equal(t, leading, l)
+	case <-time.After(5 * time.Second):
+		t.Errorf("Timeout waiting for the leadership to be %v", leading)
+	}
+}
+
+func (c *candidate) expectStandby(t *testing.T) {
+	select {
+	case <-c.leading:
+		t.Error("Two candidates lead at the same time")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mohotani-election")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "leader.lock")
+	l := &testLogger{messages: make(chan string, 100)}
+	first := &File{Path: path, Identity: "first", RetryPeriod: 10 * time.Millisecond, Logger: logger.FromPrintf(l)}
+	second := &File{Path: path, Identity: "second", RetryPeriod: 10 * time.Millisecond, Logger: logger.FromPrintf(l)}
+
+	c1 := campaign(first)
+	c1.expect(t, true)
+	assert.True(t, first.IsLeader())
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+
+	c2 := campaign(second)
+	c2.expectStandby(t)
+	assert.False(t, second.IsLeader())
+
+	c1.cancel()
+	c1.expect(t, false)
+	assert.NoError(t, <-c1.done)
+	assert.False(t, first.IsLeader())
+	c2.expect(t, true)
+	assert.True(t, second.IsLeader())
+	content, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", string(content))
+
+	c2.cancel()
+	c2.expect(t, false)
+	assert.NoError(t, <-c2.done)
+
+	close(l.messages)
+	messages := []string{}
+	for m := range l.messages {
+		messages = append(messages, m)
+	}
+	assert.Equal(t, []string{
+		"acquired the leadership lock=" + path + " identity=first",
+		"standing by lock=" + path + " identity=second leader=first",
+		"released the leadership lock=" + path + " identity=first",
+		"acquired the leadership lock=" + path + " identity=second",
+		"released the leadership lock=" + path + " identity=second",
+	}, messages)
+
+	err = (&File{Path: filepath.Join(dir, "missing", "leader.lock"), Logger: logger.FromPrintf(l)}).Run(context.Background(), func(context.Context) {})
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package election
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock tries to acquire an exclusive lock on file, it returns false when another process holds it
+func lock(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
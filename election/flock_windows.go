@@ -0,0 +1,14 @@
+package election
+
+import (
+	"fmt"
+	"os"
+)
+
+func lock(file *os.File) (bool, error) {
+	return false, fmt.Errorf("file locks are not supported on windows")
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
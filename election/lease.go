@@ -0,0 +1,98 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+// Lease elects the leader holding a kubernetes Lease object
+type Lease struct {
+	leadership
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+	// Identity is the unique name of the instance among the candidates
+	Identity string
+	// LeaseDuration is the duration candidates wait before taking over the lease of a leader that stopped renewing it
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration the leader retries renewing the lease before giving up the leadership
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between attempts to acquire or renew the lease
+	RetryPeriod time.Duration
+	Logger      logger.Logger
+}
+
+// fields returns the log fields of the lease and the identity of the instance
+func (l *Lease) fields() []logger.Field {
+	return []logger.Field{logger.F("lease", l.Namespace+"/"+l.Name), logger.F("identity", l.Identity)}
+}
+
+// Run implements the Elector interface, the lease is released when ctx is done
+func (l *Lease) Run(ctx context.Context, lead func(context.Context)) error {
+	for ctx.Err() == nil {
+		// the leader elector starts lead in the background and does not wait for it to return
+		var lock sync.Mutex
+		var running chan struct{}
+		stopped := false
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Namespace: l.Namespace, Name: l.Name},
+				Client:     l.Client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: l.Identity},
+			},
+			LeaseDuration:   l.LeaseDuration,
+			RenewDeadline:   l.RenewDeadline,
+			RetryPeriod:     l.RetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            l.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					lock.Lock()
+					if stopped {
+						lock.Unlock()
+						return
+					}
+					done := make(chan struct{})
+					running = done
+					lock.Unlock()
+					defer close(done)
+					l.set(true)
+					l.Logger.Info("acquired the leadership", l.fields()...)
+					lead(ctx)
+				},
+				OnStoppedLeading: func() {
+					if l.IsLeader() {
+						l.set(false)
+						l.Logger.Warn("lost the leadership", l.fields()...)
+					}
+				},
+				OnNewLeader: func(identity string) {
+					if identity != l.Identity {
+						l.Logger.Info("standing by", append(l.fields(), logger.F("leader", identity))...)
+					}
+				},
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "invalid leader election configuration")
+		}
+		elector.Run(ctx)
+		lock.Lock()
+		stopped = true
+		done := running
+		lock.Unlock()
+		if done != nil {
+			<-done
+		}
+	}
+	return nil
+}
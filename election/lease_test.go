@@ -0,0 +1,55 @@
+package election
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+func TestLease(t *testing.T) {
+	c := fake.NewSimpleClientset()
+	l := &testLogger{messages: make(chan string, 100)}
+	newLease := func(identity string) *Lease {
+		return &Lease{
+			Client:        c,
+			Namespace:     "dns",
+			Name:          "mohotani",
+			Identity:      identity,
+			LeaseDuration: time.Second,
+			RenewDeadline: 500 * time.Millisecond,
+			RetryPeriod:   50 * time.Millisecond,
+			Logger:        logger.FromPrintf(l),
+		}
+	}
+	first := newLease("first")
+	second := newLease("second")
+
+	c1 := campaign(first)
+	c1.expect(t, true)
+	assert.True(t, first.IsLeader())
+
+	c2 := campaign(second)
+	c2.expectStandby(t)
+	assert.False(t, second.IsLeader())
+
+	// the lease is released when the leader stops
+	c1.cancel()
+	c1.expect(t, false)
+	assert.NoError(t, <-c1.done)
+	assert.False(t, first.IsLeader())
+	c2.expect(t, true)
+	assert.True(t, second.IsLeader())
+
+	c2.cancel()
+	c2.expect(t, false)
+	assert.NoError(t, <-c2.done)
+
+	invalid := newLease("invalid")
+	invalid.RenewDeadline = 2 * time.Second
+	assert.Error(t, invalid.Run(context.Background(), func(context.Context) {}))
+}
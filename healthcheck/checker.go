@@ -0,0 +1,100 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Checker defines methods an object must implement to check the health of a target IP
+type Checker interface {
+	// Check returns an error when the target is not healthy,
+	// the target is unhealthy when ctx is done before it answers
+	Check(ctx context.Context, ip string) error
+}
+
+// TCP checks that a target accepts TCP connections
+type TCP struct {
+	Port    int
+	Timeout time.Duration
+}
+
+// Check implements the Checker interface
+func (t *TCP) Check(ctx context.Context, ip string) error {
+	dialer := net.Dialer{Timeout: t.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(t.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTP checks that a target answers http or https requests with the expected status
+type HTTP struct {
+	// Scheme is either http or https
+	Scheme string
+	// Port defaults to the scheme port when zero
+	Port int
+	Path string
+	// Host is sent as the request host and used as TLS server name (SNI)
+	Host string
+	// ExpectedStatus is the status code a healthy target answers, defaults to 200
+	ExpectedStatus int
+	Timeout        time.Duration
+	// InsecureSkipVerify disables the verification of the target certificate
+	InsecureSkipVerify bool
+}
+
+// Check implements the Checker interface
+func (h *HTTP) Check(ctx context.Context, ip string) error {
+	scheme := h.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	port := h.Port
+	if port == 0 {
+		port = 80
+		if scheme == "https" {
+			port = 443
+		}
+	}
+	expected := h.ExpectedStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(ip, strconv.Itoa(port)), h.Path), nil)
+	if err != nil {
+		return err
+	}
+	if h.Host != "" {
+		request.Host = h.Host
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			ServerName:         h.Host,
+			InsecureSkipVerify: h.InsecureSkipVerify,
+		},
+	}
+	// each check opens a new connection, it is not kept for the next check
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Timeout:   h.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != expected {
+		return fmt.Errorf("unexpected http code %d from %s. expecting %d", response.StatusCode, request.URL, expected)
+	}
+	return nil
+}
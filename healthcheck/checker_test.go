@@ -0,0 +1,105 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hostPort(t *testing.T, rawURL string) (string, int) {
+	u, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+	host, p, err := net.SplitHostPort(u.Host)
+	assert.NoError(t, err)
+	port, err := strconv.Atoi(p)
+	assert.NoError(t, err)
+	return host, port
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	c := TCP{Port: port, Timeout: time.Second}
+	assert.NoError(t, c.Check(context.Background(), "127.0.0.1"))
+
+	l.Close()
+	assert.Error(t, c.Check(context.Background(), "127.0.0.1"))
+}
+
+func TestHTTP(t *testing.T) {
+	var host string
+	status := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		if r.URL.Path != "/ping" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+	ip, port := hostPort(t, s.URL)
+
+	c := HTTP{Port: port, Path: "/ping", Host: "www.example.com", Timeout: time.Second}
+	assert.NoError(t, c.Check(context.Background(), ip))
+	assert.Equal(t, "www.example.com", host)
+
+	status = http.StatusServiceUnavailable
+	err := c.Check(context.Background(), ip)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+
+	c.ExpectedStatus = http.StatusServiceUnavailable
+	assert.NoError(t, c.Check(context.Background(), ip))
+
+	s.Close()
+	assert.Error(t, c.Check(context.Background(), ip))
+}
+
+func TestHTTPClosesConnections(t *testing.T) {
+	closed := make(chan struct{}, 10)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	s.Start()
+	defer s.Close()
+	ip, port := hostPort(t, s.URL)
+
+	c := HTTP{Port: port, Timeout: time.Second}
+	assert.NoError(t, c.Check(context.Background(), ip))
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Error("the connection of the check was left open")
+	}
+}
+
+func TestHTTPS(t *testing.T) {
+	var serverName string
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+	}))
+	s.StartTLS()
+	defer s.Close()
+	ip, port := hostPort(t, s.URL)
+
+	c := HTTP{Scheme: "https", Port: port, Host: "www.example.com", Timeout: time.Second}
+	err := c.Check(context.Background(), ip)
+	assert.Error(t, err)
+
+	c.InsecureSkipVerify = true
+	assert.NoError(t, c.Check(context.Background(), ip))
+	assert.Equal(t, "www.example.com", serverName)
+}
@@ -0,0 +1,138 @@
+package healthcheck
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tjamet/mohotani/listener"
+	"github.com/tjamet/mohotani/logger"
+)
+
+type target struct {
+	checked   bool
+	healthy   bool
+	successes int
+	failures  int
+}
+
+// Listener forwards the healthy targets out of the lists of targets of a Listener
+type Listener struct {
+	// Listener is the listener providing the targets to check
+	Listener listener.Listener
+	// Checker checks the health of each target
+	Checker Checker
+	// Ticker is the channel controlling the check interval (typically fed by time.NewTicker(10 * time.Second))
+	Ticker <-chan time.Time
+	// Rise is the number of consecutive successful checks before a target is healthy again
+	Rise int
+	// Fall is the number of consecutive failed checks before a target is unhealthy
+	Fall int
+	// Fallback is the list of targets forwarded when none is healthy.
+	// When empty, the last forwarded targets are kept in place
+	Fallback []string
+	// Logger is the logger in which health changes will be printed
+	Logger logger.Logger
+
+	targets map[string]*target
+	order   []string
+}
+
+// Listen implements the Listener interface and forwards changes in the healthy targets to out.
+// The first check of a target decides its initial health
+func (l *Listener) Listen(ctx context.Context, out chan []string) {
+	in := make(chan []string)
+	go l.Listener.Listen(ctx, in)
+	l.targets = map[string]*target{}
+	var published []string
+	for {
+		select {
+		case ips := <-in:
+			l.setTargets(ips)
+		case <-l.Ticker:
+		case <-ctx.Done():
+			return
+		}
+		if len(l.order) == 0 {
+			continue
+		}
+		l.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		healthy := l.healthy()
+		if len(healthy) == 0 {
+			if len(l.Fallback) == 0 {
+				l.Logger.Error("no healthy target, keeping the published IPs", logger.F("targets", l.order), logger.IPs(published))
+				continue
+			}
+			l.Logger.Error("no healthy target, using the fallback IPs", logger.F("targets", l.order), logger.IPs(l.Fallback))
+			healthy = l.Fallback
+		}
+		if !reflect.DeepEqual(healthy, published) {
+			if !listener.Send(ctx, out, healthy) {
+				return
+			}
+			published = healthy
+		}
+	}
+}
+
+func (l *Listener) setTargets(ips []string) {
+	targets := map[string]*target{}
+	for _, ip := range ips {
+		if t, ok := l.targets[ip]; ok {
+			targets[ip] = t
+		} else {
+			targets[ip] = &target{}
+		}
+	}
+	l.targets = targets
+	l.order = ips
+}
+
+func (l *Listener) check(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	lock := sync.Mutex{}
+	for _, ip := range l.order {
+		wg.Add(1)
+		go func(ip string, t *target) {
+			defer wg.Done()
+			err := l.Checker.Check(ctx, ip)
+			lock.Lock()
+			defer lock.Unlock()
+			l.record(ip, t, err)
+		}(ip, l.targets[ip])
+	}
+	wg.Wait()
+}
+
+func (l *Listener) record(ip string, t *target, err error) {
+	if err != nil {
+		t.successes = 0
+		t.failures++
+		if !t.checked || (t.healthy && t.failures >= l.Fall) {
+			l.Logger.Warn("target is unhealthy", logger.F("target", ip), logger.Err(err))
+			t.healthy = false
+		}
+	} else {
+		t.failures = 0
+		t.successes++
+		if !t.checked || (!t.healthy && t.successes >= l.Rise) {
+			l.Logger.Info("target is healthy", logger.F("target", ip))
+			t.healthy = true
+		}
+	}
+	t.checked = true
+}
+
+func (l *Listener) healthy() []string {
+	healthy := []string{}
+	for _, ip := range l.order {
+		if l.targets[ip].healthy {
+			healthy = append(healthy, ip)
+		}
+	}
+	return healthy
+}
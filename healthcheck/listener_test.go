@@ -0,0 +1,137 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type testListener struct {
+	c chan chan []string
+}
+
+func (l *testListener) Listen(ctx context.Context, c chan []string) {
+	l.c <- c
+}
+
+type testChecker struct {
+	lock    sync.Mutex
+	healthy map[string]bool
+}
+
+func (c *testChecker) set(ip string, healthy bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.healthy[ip] = healthy
+}
+
+func (c *testChecker) Check(ctx context.Context, ip string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.healthy[ip] {
+		return nil
+	}
+	return fmt.Errorf("%s is down", ip)
+}
+
+func receive(t *testing.T, out chan []string) []string {
+	select {
+	case ips := <-out:
+		return ips
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+		return nil
+	}
+}
+
+func assertNothingReceived(t *testing.T, out chan []string) {
+	select {
+	case ips := <-out:
+		t.Errorf("Unexpected targets %s received", ips)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestListener(t *testing.T) {
+	inner := &testListener{make(chan chan []string)}
+	checker := &testChecker{healthy: map[string]bool{"203.0.113.1": true, "203.0.113.2": false}}
+	ticker := make(chan time.Time)
+	out := make(chan []string)
+	l := &Listener{
+		Listener: inner,
+		Checker:  checker,
+		Ticker:   ticker,
+		Rise:     2,
+		Fall:     2,
+		Logger:   logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+	}
+	go l.Listen(context.Background(), out)
+	in := <-inner.c
+
+	in <- []string{"203.0.113.1", "203.0.113.2"}
+	assert.Equal(t, []string{"203.0.113.1"}, receive(t, out))
+
+	checker.set("203.0.113.2", true)
+	ticker <- time.Now()
+	assertNothingReceived(t, out)
+	ticker <- time.Now()
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, receive(t, out))
+
+	checker.set("203.0.113.1", false)
+	ticker <- time.Now()
+	assertNothingReceived(t, out)
+	ticker <- time.Now()
+	assert.Equal(t, []string{"203.0.113.2"}, receive(t, out))
+
+	in <- []string{"203.0.113.2", "203.0.113.3"}
+	assertNothingReceived(t, out)
+
+	checker.set("203.0.113.3", true)
+	in <- []string{"203.0.113.2", "203.0.113.4"}
+	assertNothingReceived(t, out)
+	in <- []string{"203.0.113.3"}
+	assert.Equal(t, []string{"203.0.113.3"}, receive(t, out))
+
+	// without fallback, the last healthy targets are kept
+	checker.set("203.0.113.3", false)
+	ticker <- time.Now()
+	ticker <- time.Now()
+	ticker <- time.Now()
+	assertNothingReceived(t, out)
+}
+
+func TestListenerFallback(t *testing.T) {
+	inner := &testListener{make(chan chan []string)}
+	checker := &testChecker{healthy: map[string]bool{"203.0.113.1": true}}
+	ticker := make(chan time.Time)
+	out := make(chan []string)
+	l := &Listener{
+		Listener: inner,
+		Checker:  checker,
+		Ticker:   ticker,
+		Rise:     1,
+		Fall:     1,
+		Fallback: []string{"198.51.100.1"},
+		Logger:   logger.New(os.Stdout, logger.Text{}, logger.DebugLevel),
+	}
+	go l.Listen(context.Background(), out)
+	in := <-inner.c
+
+	in <- []string{"203.0.113.1"}
+	assert.Equal(t, []string{"203.0.113.1"}, receive(t, out))
+
+	checker.set("203.0.113.1", false)
+	ticker <- time.Now()
+	assert.Equal(t, []string{"198.51.100.1"}, receive(t, out))
+
+	checker.set("203.0.113.1", true)
+	ticker <- time.Now()
+	assert.Equal(t, []string{"203.0.113.1"}, receive(t, out))
+}
@@ -0,0 +1,106 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/tjamet/mohotani/metrics"
+)
+
+var (
+	resolutionsTotal      = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_ip_resolutions_total", Help: "The number of resolutions of the resolvers combined in a chain, by resolution method"}, []string{"resolver"})
+	resolutionErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_ip_resolution_errors_total", Help: "The number of failed resolutions of the resolvers combined in a chain, by resolution method"}, []string{"resolver"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(resolutionsTotal, resolutionErrorsTotal)
+}
+
+// FirstSuccess is a resolver that tries its resolvers in order and returns the first successful resolution
+type FirstSuccess struct {
+	Resolvers []Resolver
+}
+
+// Resolve implements the Resolver interface
+func (f *FirstSuccess) Resolve(ctx context.Context) ([]string, error) {
+	errs := []string{}
+	for _, r := range f.Resolvers {
+		ips, err := r.Resolve(ctx)
+		if err == nil {
+			return ips, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("all resolvers failed: [%s]", strings.Join(errs, "; "))
+}
+
+// Union is a resolver that merges the IPs of all its resolvers.
+// The resolution fails when any of the resolvers fails, so that a partial list of IPs is never returned
+type Union struct {
+	Resolvers []Resolver
+}
+
+// Resolve implements the Resolver interface
+func (u *Union) Resolve(ctx context.Context) ([]string, error) {
+	ips := []string{}
+	seen := map[string]interface{}{}
+	for _, r := range u.Resolvers {
+		resolved, err := r.Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range resolved {
+			if _, ok := seen[ip]; !ok {
+				seen[ip] = nil
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// Sticky is a resolver that returns the last IPs successfully resolved by its resolver
+// for up to MaxFailures consecutive failures. Wrapping the members of FirstSuccess or Union,
+// it keeps a briefly failing member from falling back to the next one, or failing the union
+type Sticky struct {
+	Resolver    Resolver
+	MaxFailures int
+
+	last     []string
+	failures int
+}
+
+// Resolve implements the Resolver interface
+func (s *Sticky) Resolve(ctx context.Context) ([]string, error) {
+	ips, err := s.Resolver.Resolve(ctx)
+	if err == nil {
+		s.last = ips
+		s.failures = 0
+		return ips, nil
+	}
+	s.failures++
+	if s.last == nil || s.failures > s.MaxFailures {
+		return nil, err
+	}
+	return s.last, nil
+}
+
+// Instrumented is a resolver counting the resolutions of its resolver in metrics under Name.
+// Wrapping the members of FirstSuccess or Union, it tells which member fails while the chain succeeds
+type Instrumented struct {
+	Resolver Resolver
+	Name     string
+}
+
+// Resolve implements the Resolver interface
+func (i *Instrumented) Resolve(ctx context.Context) ([]string, error) {
+	ips, err := i.Resolver.Resolve(ctx)
+	resolutionsTotal.WithLabelValues(i.Name).Inc()
+	if err != nil {
+		resolutionErrorsTotal.WithLabelValues(i.Name).Inc()
+	}
+	return ips, err
+}
@@ -0,0 +1,137 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testResolver struct {
+	ips []string
+	err error
+}
+
+func (r *testResolver) Resolve(ctx context.Context) ([]string, error) {
+	return r.ips, r.err
+}
+
+func TestFirstSuccess(t *testing.T) {
+	r1 := &testResolver{err: fmt.Errorf("router unreachable")}
+	r2 := &testResolver{ips: []string{"203.0.113.2"}}
+	f := FirstSuccess{[]Resolver{r1, r2}}
+	ips, err := f.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.2"}, ips)
+
+	r1.ips, r1.err = []string{"203.0.113.1"}, nil
+	ips, err = f.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+
+	r1.err = fmt.Errorf("router unreachable")
+	r2.err = fmt.Errorf("ipify unreachable")
+	ips, err = f.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "router unreachable")
+	assert.Contains(t, err.Error(), "ipify unreachable")
+}
+
+func TestUnion(t *testing.T) {
+	r1 := &testResolver{ips: []string{"203.0.113.1", "203.0.113.2"}}
+	r2 := &testResolver{ips: []string{"203.0.113.2", "2001:db8::1"}}
+	u := Union{[]Resolver{r1, r2}}
+	ips, err := u.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2", "2001:db8::1"}, ips)
+
+	r2.err = fmt.Errorf("test error")
+	ips, err = u.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+}
+
+func TestSticky(t *testing.T) {
+	r := &testResolver{err: fmt.Errorf("test error")}
+	s := Sticky{Resolver: r, MaxFailures: 2}
+	ips, err := s.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+
+	r.ips, r.err = []string{"203.0.113.1"}, nil
+	ips, err = s.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+
+	r.ips, r.err = nil, fmt.Errorf("test error")
+	for i := 0; i < 2; i++ {
+		ips, err = s.Resolve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"203.0.113.1"}, ips)
+	}
+	ips, err = s.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+
+	r.ips, r.err = []string{"203.0.113.2"}, nil
+	ips, err = s.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.2"}, ips)
+
+	r.ips, r.err = nil, fmt.Errorf("test error")
+	ips, err = s.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.2"}, ips)
+}
+
+func TestStickyMembers(t *testing.T) {
+	r1 := &testResolver{ips: []string{"203.0.113.1"}}
+	r2 := &testResolver{ips: []string{"203.0.113.2"}}
+	f := FirstSuccess{[]Resolver{&Sticky{Resolver: r1, MaxFailures: 1}, &Sticky{Resolver: r2, MaxFailures: 1}}}
+	u := Union{[]Resolver{&Sticky{Resolver: r1, MaxFailures: 1}, &Sticky{Resolver: r2, MaxFailures: 1}}}
+	for _, r := range []Resolver{&f, &u} {
+		_, err := r.Resolve(context.Background())
+		assert.NoError(t, err)
+	}
+
+	// a failing member keeps its IPs instead of falling back to the next member or failing the union
+	r1.ips, r1.err = nil, fmt.Errorf("test error")
+	ips, err := f.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+	ips, err = u.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, ips)
+
+	ips, err = f.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.2"}, ips)
+	_, err = u.Resolve(context.Background())
+	assert.Error(t, err)
+}
+
+func TestInstrumented(t *testing.T) {
+	r1 := &testResolver{err: fmt.Errorf("router unreachable")}
+	r2 := &testResolver{ips: []string{"203.0.113.2"}}
+	f := FirstSuccess{[]Resolver{&Instrumented{Resolver: r1, Name: "test-router"}, &Instrumented{Resolver: r2, Name: "test-ipify"}}}
+	// the counters outlive the test in the default registry, only their increments are checked
+	routerResolutions := testutil.ToFloat64(resolutionsTotal.WithLabelValues("test-router"))
+	routerErrors := testutil.ToFloat64(resolutionErrorsTotal.WithLabelValues("test-router"))
+	ipifyResolutions := testutil.ToFloat64(resolutionsTotal.WithLabelValues("test-ipify"))
+	ipifyErrors := testutil.ToFloat64(resolutionErrorsTotal.WithLabelValues("test-ipify"))
+	ips, err := f.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.2"}, ips)
+
+	r1.ips, r1.err = []string{"203.0.113.1"}, nil
+	_, err = f.Resolve(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, routerResolutions+2, testutil.ToFloat64(resolutionsTotal.WithLabelValues("test-router")))
+	assert.Equal(t, routerErrors+1, testutil.ToFloat64(resolutionErrorsTotal.WithLabelValues("test-router")))
+	assert.Equal(t, ipifyResolutions+1, testutil.ToFloat64(resolutionsTotal.WithLabelValues("test-ipify")))
+	assert.Equal(t, ipifyErrors, testutil.ToFloat64(resolutionErrorsTotal.WithLabelValues("test-ipify")))
+}
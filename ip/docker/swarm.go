@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	listerDocker "github.com/tjamet/mohotani/dns/lister/docker"
+	"github.com/tjamet/mohotani/ip"
+	"github.com/tjamet/mohotani/logger"
+)
+
+// SwarmNodes resolves the public addresses of the swarm nodes currently running
+// a task of a service, typically the reverse proxy
+type SwarmNodes struct {
+	Client *client.Client
+	Logger logger.Logger
+	// Service is the name or ID of the service whose tasks are looked up
+	Service string
+	// Label is the optional node label holding the public address of a node.
+	// When empty, or when a node does not have the label, the node address is used
+	Label string
+	// AllowBogons publishes node addresses that are not publicly routable, they are skipped otherwise.
+	// Addresses given by Label are always published
+	AllowBogons bool
+}
+
+// Resolve implements the Resolver interface and returns the addresses of the nodes running a healthy task of the service.
+// It fails when no healthy task of the service is running, or when none of their nodes has a publicly routable address
+func (s *SwarmNodes) Resolve(ctx context.Context) ([]string, error) {
+	f := filters.NewArgs()
+	f.Add("service", s.Service)
+	f.Add("desired-state", string(swarm.TaskStateRunning))
+	tasks, err := s.Client.TaskList(ctx, types.TaskListOptions{Filters: f})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to list tasks of service %s", s.Service))
+	}
+	addresses := map[string]interface{}{}
+	nodes := map[string]interface{}{}
+	private := 0
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning || task.NodeID == "" {
+			continue
+		}
+		if _, ok := nodes[task.NodeID]; ok {
+			continue
+		}
+		healthy, err := s.healthy(ctx, task)
+		if err != nil {
+			return nil, err
+		}
+		if !healthy {
+			continue
+		}
+		nodes[task.NodeID] = nil
+		node, _, err := s.Client.NodeInspectWithRaw(ctx, task.NodeID)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("unable to inspect node %s running service %s", task.NodeID, s.Service))
+		}
+		address := node.Status.Addr
+		labelled := false
+		if value, ok := node.Spec.Labels[s.Label]; s.Label != "" && ok {
+			address = value
+			labelled = true
+		}
+		parsed := net.ParseIP(address)
+		if parsed == nil {
+			s.Logger.Warn("ignoring node running the service, its address is not an IP", logger.F("node", node.Description.Hostname), logger.F("service", s.Service), logger.F("address", address))
+			continue
+		}
+		if !labelled && !s.AllowBogons && bogon(parsed) {
+			s.Logger.Warn("ignoring node running the service, its address is not publicly routable, its public address should be set in a node label",
+				logger.F("node", node.Description.Hostname), logger.F("service", s.Service), logger.F("address", address))
+			private++
+			continue
+		}
+		addresses[address] = nil
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no healthy task of service %s is running", s.Service)
+	}
+	if len(addresses) == 0 && private > 0 {
+		return nil, fmt.Errorf("none of the %d nodes running service %s has a publicly routable address", private, s.Service)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("none of the %d nodes running service %s has an IP address", len(nodes), s.Service)
+	}
+	ips := []string{}
+	for address := range addresses {
+		ips = append(ips, address)
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// healthy returns whether the container of a running task passes its health check.
+// Swarm only reports a task running once its container is healthy, the containers the daemon can inspect, the ones
+// of its own node, are also checked so that a task turning unhealthy is skipped before swarm replaces it
+func (s *SwarmNodes) healthy(ctx context.Context, task swarm.Task) (bool, error) {
+	id := task.Status.ContainerStatus.ContainerID
+	if id == "" {
+		return true, nil
+	}
+	container, err := s.Client.ContainerInspect(ctx, id)
+	if client.IsErrContainerNotFound(err) {
+		// the container runs on another node
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("unable to inspect container %s of service %s", id, s.Service))
+	}
+	if container.ContainerJSONBase == nil || container.State == nil || container.State.Health == nil {
+		return true, nil
+	}
+	if container.State.Health.Status != types.Healthy {
+		s.Logger.Warn("ignoring node running the service, its task is not healthy", logger.F("node", task.NodeID), logger.F("service", s.Service),
+			logger.F("container", id), logger.F("health", container.State.Health.Status))
+		return false, nil
+	}
+	return true, nil
+}
+
+func bogon(address net.IP) bool {
+	for _, network := range ip.Bogons {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventTicker proxies a ticker and adds ticks for each service, node and container events
+// until ctx is done
+func (s *SwarmNodes) EventTicker(ctx context.Context, c <-chan time.Time) <-chan time.Time {
+	return listerDocker.EventTicker(ctx, s.Client, s.Logger, c, "service", "node", "container")
+}
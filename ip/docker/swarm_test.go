@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type testLogger struct{}
+
+func (t testLogger) Printf(f string, v ...interface{}) {
+	log.Printf(f, v...)
+}
+
+type testSwarmHandler struct {
+	tasks      []swarm.Task
+	nodes      map[string]swarm.Node
+	containers map[string]string
+	filters    []string
+}
+
+func (t *testSwarmHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/tasks"):
+		t.filters = append(t.filters, r.URL.Query().Get("filters"))
+		json.NewEncoder(w).Encode(t.tasks)
+	case strings.Contains(r.URL.Path, "/nodes/"):
+		node, ok := t.nodes[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(node)
+	case strings.HasSuffix(r.URL.Path, "/json") && strings.Contains(r.URL.Path, "/containers/"):
+		parts := strings.Split(r.URL.Path, "/")
+		health, ok := t.containers[parts[len(parts)-2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Health: &types.Health{Status: health}}}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testNode(id, addr string, labels map[string]string) swarm.Node {
+	node := swarm.Node{ID: id}
+	node.Status.Addr = addr
+	node.Spec.Labels = labels
+	return node
+}
+
+func testTask(node string, state swarm.TaskState) swarm.Task {
+	return swarm.Task{NodeID: node, DesiredState: swarm.TaskStateRunning, Status: swarm.TaskStatus{State: state}}
+}
+
+func TestSwarmNodes(t *testing.T) {
+	h := &testSwarmHandler{
+		tasks: []swarm.Task{
+			testTask("node-1", swarm.TaskStateRunning),
+			testTask("node-2", swarm.TaskStateRunning),
+			testTask("node-2", swarm.TaskStateRunning),
+			testTask("node-3", swarm.TaskStateStarting),
+		},
+		nodes: map[string]swarm.Node{
+			"node-1": testNode("node-1", "10.0.0.1", map[string]string{"mohotani.public-ip": "203.0.113.1"}),
+			"node-2": testNode("node-2", "10.0.0.2", nil),
+			"node-3": testNode("node-3", "10.0.0.3", nil),
+		},
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+	cl, err := client.NewClient("tcp://"+strings.TrimPrefix(s.URL, "http://"), "1.25", nil, nil)
+	assert.NoError(t, err)
+
+	r := SwarmNodes{Client: cl, Logger: logger.FromPrintf(testLogger{}), Service: "traefik"}
+	ips, err := r.Resolve(context.Background())
+	assert.EqualError(t, err, "none of the 2 nodes running service traefik has a publicly routable address")
+	assert.Nil(t, ips)
+	assert.Contains(t, h.filters[0], "traefik")
+	assert.Contains(t, h.filters[0], "running")
+
+	r.AllowBogons = true
+	ips, err = r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, ips)
+
+	// labelled addresses are published, private node addresses are skipped
+	r.AllowBogons = false
+	r.Label = "mohotani.public-ip"
+	ips, err = r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+
+	r.AllowBogons = true
+	ips, err = r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "203.0.113.1"}, ips)
+
+	h.nodes["node-2"] = testNode("node-2", "", map[string]string{"mohotani.public-ip": "not an ip"})
+	ips, err = r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+
+	h.nodes["node-1"] = testNode("node-1", "", map[string]string{"mohotani.public-ip": "not an ip"})
+	ips, err = r.Resolve(context.Background())
+	assert.EqualError(t, err, "none of the 2 nodes running service traefik has an IP address")
+	assert.Nil(t, ips)
+
+	delete(h.nodes, "node-1")
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "node-1")
+}
+
+func TestSwarmNodesHealth(t *testing.T) {
+	h := &testSwarmHandler{
+		tasks: []swarm.Task{
+			testTask("node-1", swarm.TaskStateRunning),
+			testTask("node-2", swarm.TaskStateRunning),
+			testTask("node-3", swarm.TaskStateRunning),
+			testTask("node-4", swarm.TaskStateStarting),
+		},
+		nodes: map[string]swarm.Node{
+			"node-1": testNode("node-1", "203.0.113.1", nil),
+			"node-2": testNode("node-2", "203.0.113.2", nil),
+			"node-3": testNode("node-3", "203.0.113.3", nil),
+			"node-4": testNode("node-4", "203.0.113.4", nil),
+		},
+		// the container of node-3 runs on another node than the daemon
+		containers: map[string]string{"container-1": types.Healthy, "container-2": types.Unhealthy},
+	}
+	for i := range h.tasks {
+		h.tasks[i].Status.ContainerStatus.ContainerID = fmt.Sprintf("container-%d", i+1)
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+	cl, err := client.NewClient("tcp://"+strings.TrimPrefix(s.URL, "http://"), "1.25", nil, nil)
+	assert.NoError(t, err)
+
+	// nodes running unhealthy or starting tasks are skipped
+	r := SwarmNodes{Client: cl, Logger: logger.FromPrintf(testLogger{}), Service: "traefik", AllowBogons: true}
+	ips, err := r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.3"}, ips)
+
+	// resolution fails when no healthy task is running
+	h.tasks = h.tasks[1:2]
+	ips, err = r.Resolve(context.Background())
+	assert.EqualError(t, err, "no healthy task of service traefik is running")
+	assert.Nil(t, ips)
+
+	h.tasks = nil
+	ips, err = r.Resolve(context.Background())
+	assert.EqualError(t, err, "no healthy task of service traefik is running")
+	assert.Nil(t, ips)
+}
@@ -0,0 +1,29 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/tjamet/mohotani/command"
+)
+
+// Exec is a resolver that runs an external command to get the IPs
+type Exec struct {
+	command.Command
+}
+
+// Resolve implements the Resolver interface.
+// Any value printed by the command that is not an IP address fails the resolution
+func (e *Exec) Resolve(ctx context.Context) ([]string, error) {
+	values, err := e.Command.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if net.ParseIP(value) == nil {
+			return nil, fmt.Errorf("unable to resolve current public address, '%s' printed by command '%s' is not an IP address", value, &e.Command)
+		}
+	}
+	return values, nil
+}
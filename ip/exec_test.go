@@ -0,0 +1,27 @@
+package ip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tjamet/mohotani/command"
+)
+
+func TestResolveExec(t *testing.T) {
+	e := Exec{command.Command{Path: "echo", Args: []string{"203.0.113.1,2001:db8::1"}}}
+	ips, err := e.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "2001:db8::1"}, ips)
+
+	e = Exec{command.Command{Path: "echo", Args: []string{"203.0.113.1,not an ip"}}}
+	ips, err = e.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "not an IP address")
+
+	e = Exec{command.Command{Path: "false"}}
+	ips, err = e.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+}
@@ -0,0 +1,127 @@
+package ip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Bogons lists the networks that are not publicly routable: private, loopback,
+// link-local, shared (CGNAT), documentation, multicast and reserved ranges
+var Bogons = mustParseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// ParseNetworks parses a list of CIDR networks. Single IP addresses are accepted as networks of one address
+func ParseNetworks(networks ...string) ([]*net.IPNet, error) {
+	r := []*net.IPNet{}
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if !strings.Contains(network, "/") {
+			address := net.ParseIP(network)
+			if address == nil {
+				return nil, fmt.Errorf("invalid network %s, expecting a CIDR network or an IP address", network)
+			}
+			bits := 8 * net.IPv6len
+			if address.To4() != nil {
+				address = address.To4()
+				bits = 8 * net.IPv4len
+			}
+			r = append(r, &net.IPNet{IP: address, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %s, expecting a CIDR network or an IP address", network)
+		}
+		r = append(r, n)
+	}
+	return r, nil
+}
+
+func mustParseNetworks(networks ...string) []*net.IPNet {
+	r, err := ParseNetworks(networks...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func contains(networks []*net.IPNet, address net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter checks IP addresses before they are published
+type Filter struct {
+	// Allow lists the networks addresses must belong to, any address is allowed when empty.
+	// Addresses of allowed networks are accepted even when they are bogons
+	Allow []*net.IPNet
+	// Deny lists the networks addresses must not belong to
+	Deny []*net.IPNet
+	// AllowBogons accepts addresses that are not publicly routable
+	AllowBogons bool
+	// AllowEmpty accepts an empty list of addresses
+	AllowEmpty bool
+}
+
+func (f *Filter) check(ip string) string {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return "not an IP address"
+	}
+	if contains(f.Deny, address) {
+		return "denied"
+	}
+	if len(f.Allow) > 0 {
+		if contains(f.Allow, address) {
+			return ""
+		}
+		return "not allowed"
+	}
+	if !f.AllowBogons && contains(Bogons, address) {
+		return "not publicly routable"
+	}
+	return ""
+}
+
+// Check returns an error when any of ips is rejected by the filter
+func (f *Filter) Check(ips []string) error {
+	if len(ips) == 0 && !f.AllowEmpty {
+		return fmt.Errorf("refusing to publish an empty list of IPs")
+	}
+	rejected := []string{}
+	for _, ip := range ips {
+		if reason := f.check(ip); reason != "" {
+			rejected = append(rejected, fmt.Sprintf("%s (%s)", ip, reason))
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("rejected IPs %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package ip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8", " 8.8.8.8", "2001:db8::/32", "2001:db8::1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(networks))
+	assert.Equal(t, "8.8.8.8/32", networks[1].String())
+	assert.Equal(t, "2001:db8::1/128", networks[3].String())
+
+	_, err = ParseNetworks("10.0.0.0/8", "not a network")
+	assert.Error(t, err)
+	_, err = ParseNetworks("10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   Filter
+		ips      []string
+		rejected []string
+	}{
+		{name: "public", filter: Filter{}, ips: []string{"8.8.8.8", "2a00:1450:4007:80a::200e"}},
+		{name: "private", filter: Filter{}, ips: []string{"8.8.8.8", "192.168.1.1", "10.1.2.3"}, rejected: []string{"192.168.1.1", "10.1.2.3"}},
+		{name: "bogons", filter: Filter{}, ips: []string{"100.64.0.1", "127.0.0.1", "169.254.169.254", "::1", "fe80::1", "fd00::1"}, rejected: []string{"100.64.0.1", "127.0.0.1", "169.254.169.254", "::1", "fe80::1", "fd00::1"}},
+		{name: "allow bogons", filter: Filter{AllowBogons: true}, ips: []string{"192.168.1.1", "10.1.2.3"}},
+		{name: "invalid", filter: Filter{AllowBogons: true}, ips: []string{"example.com"}, rejected: []string{"example.com"}},
+		{name: "empty", filter: Filter{}, ips: []string{}, rejected: []string{"empty"}},
+		{name: "allow empty", filter: Filter{AllowEmpty: true}, ips: []string{}},
+		{name: "deny", filter: Filter{Deny: mustParseNetworks("8.8.0.0/16")}, ips: []string{"8.8.8.8", "1.1.1.1"}, rejected: []string{"8.8.8.8"}},
+		{name: "allow", filter: Filter{Allow: mustParseNetworks("1.1.1.0/24", "10.0.0.0/8")}, ips: []string{"8.8.8.8", "1.1.1.1", "10.1.2.3"}, rejected: []string{"8.8.8.8"}},
+		{name: "deny and allow", filter: Filter{Allow: mustParseNetworks("10.0.0.0/8"), Deny: mustParseNetworks("10.1.0.0/16")}, ips: []string{"10.1.2.3", "10.2.2.3"}, rejected: []string{"10.1.2.3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.filter.Check(test.ips)
+			if len(test.rejected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			for _, rejected := range test.rejected {
+				assert.Contains(t, err.Error(), rejected)
+			}
+			for _, ip := range test.ips {
+				found := false
+				for _, rejected := range test.rejected {
+					found = found || rejected == ip
+				}
+				if !found {
+					assert.NotContains(t, err.Error(), ip+" ")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package ip
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Hostnames is a resolver that resolves hostnames to their current IPs.
+// It allows domains to point wherever another name points, even at the apex where CNAME records are not allowed
+type Hostnames struct {
+	Names []string
+	// Server is the address of the DNS server to query, with format <host>:<port>.
+	// The system resolver is used when empty
+	Server string
+	// Timeout is the maximum duration of the resolution of all names, no timeout is applied when zero
+	Timeout time.Duration
+}
+
+func (h *Hostnames) resolver() *net.Resolver {
+	if h.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, h.Server)
+		},
+	}
+}
+
+// Resolve implements the Resolver interface and returns the sorted A and AAAA records of all names
+func (h *Hostnames) Resolve(ctx context.Context) ([]string, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	resolver := h.resolver()
+	addresses := map[string]interface{}{}
+	for _, name := range h.Names {
+		ips, err := resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to resolve "+name)
+		}
+		for _, ip := range ips {
+			addresses[ip.IP.String()] = nil
+		}
+	}
+	r := []string{}
+	for address := range addresses {
+		r = append(r, address)
+	}
+	sort.Strings(r)
+	return r, nil
+}
@@ -0,0 +1,86 @@
+package ip
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers A and AAAA queries from records until the connection is closed
+func serveDNS(conn net.PacketConn, records map[string][]net.IP) {
+	buffer := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buffer[:n]) != nil || len(query.Questions) == 0 {
+			continue
+		}
+		question := query.Questions[0]
+		answer := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+			Questions: query.Questions,
+		}
+		ips, ok := records[question.Name.String()]
+		if !ok {
+			answer.RCode = dnsmessage.RCodeNameError
+		}
+		for _, ip := range ips {
+			header := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			if ip4 := ip.To4(); ip4 != nil && question.Type == dnsmessage.TypeA {
+				header.Type = dnsmessage.TypeA
+				r := &dnsmessage.AResource{}
+				copy(r.A[:], ip4)
+				answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: r})
+			}
+			if ip.To4() == nil && question.Type == dnsmessage.TypeAAAA {
+				header.Type = dnsmessage.TypeAAAA
+				r := &dnsmessage.AAAAResource{}
+				copy(r.AAAA[:], ip)
+				answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: r})
+			}
+		}
+		b, err := answer.Pack()
+		if err == nil {
+			conn.WriteTo(b, addr)
+		}
+	}
+}
+
+func TestResolveHostnames(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	go serveDNS(conn, map[string][]net.IP{
+		"lb.example.net.":  {net.ParseIP("203.0.113.2"), net.ParseIP("203.0.113.1"), net.ParseIP("2001:db8::1")},
+		"lb2.example.net.": {net.ParseIP("203.0.113.1"), net.ParseIP("203.0.113.3")},
+	})
+
+	h := Hostnames{
+		Names:   []string{"lb.example.net", "lb2.example.net"},
+		Server:  conn.LocalAddr().String(),
+		Timeout: 3 * time.Second,
+	}
+	ips, err := h.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::1", "203.0.113.1", "203.0.113.2", "203.0.113.3"}, ips)
+
+	h.Names = []string{"lb.example.net", "unknown.example.net"}
+	ips, err = h.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "unknown.example.net")
+}
+
+func TestResolveHostnamesSystem(t *testing.T) {
+	h := Hostnames{Names: []string{"localhost"}}
+	ips, err := h.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, ips, "127.0.0.1")
+}
@@ -0,0 +1,167 @@
+package ip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Parser extracts the IP addresses out of a response body
+type Parser func([]byte) ([]string, error)
+
+// PlainText is a parser that reads addresses separated by spaces, commas or new lines
+func PlainText(body []byte) ([]string, error) {
+	return strings.FieldsFunc(string(body), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}), nil
+}
+
+// JSONPath returns a parser that reads addresses out of a JSON document.
+// The path is a list of keys or array indexes separated by dots, e.g. data.addresses.0 or $.data.addresses[0].
+// When the path points to an array, all its elements are returned
+func JSONPath(path string) Parser {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.Replace(strings.Replace(path, "[", ".", -1), "]", "", -1)
+	keys := []string{}
+	if path != "" {
+		keys = strings.Split(path, ".")
+	}
+	return func(body []byte) ([]string, error) {
+		var document interface{}
+		err := json.Unmarshal(body, &document)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse json")
+		}
+		for _, key := range keys {
+			switch value := document.(type) {
+			case map[string]interface{}:
+				document = value[key]
+			case []interface{}:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(value) {
+					return nil, fmt.Errorf("invalid index %s in json path %s", key, path)
+				}
+				document = value[index]
+			default:
+				return nil, fmt.Errorf("key %s not found in json path %s", key, path)
+			}
+		}
+		switch value := document.(type) {
+		case string:
+			return []string{value}, nil
+		case []interface{}:
+			values := []string{}
+			for _, v := range value {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("unexpected value %v in json path %s, expecting a string", v, path)
+				}
+				values = append(values, s)
+			}
+			return values, nil
+		default:
+			return nil, fmt.Errorf("unexpected value %v in json path %s, expecting a string or a list of strings", document, path)
+		}
+	}
+}
+
+// Regexp returns a parser that returns all the matches of expression in the body.
+// When the expression has a capture group, the value of the first group is returned instead of the whole match
+func Regexp(expression *regexp.Regexp) Parser {
+	return func(body []byte) ([]string, error) {
+		values := []string{}
+		for _, match := range expression.FindAllSubmatch(body, -1) {
+			if len(match) > 1 {
+				values = append(values, string(match[1]))
+			} else {
+				values = append(values, string(match[0]))
+			}
+		}
+		return values, nil
+	}
+}
+
+// maxResponseSize is the maximum size of the response bodies read by HTTP
+const maxResponseSize = 1 << 20
+
+// HTTP implements a resolver that reads the IP addresses from any http endpoint
+type HTTP struct {
+	URL      string
+	Headers  map[string]string
+	Username string
+	Password string
+	Timeout  time.Duration
+	// Parser extracts addresses from the response body, defaults to PlainText
+	Parser Parser
+}
+
+// NewHTTP instanciates a new http IP address resolver reading plain text addresses from url
+func NewHTTP(url string) *HTTP {
+	return &HTTP{
+		URL:     url,
+		Headers: map[string]string{},
+		Timeout: 10 * time.Second,
+		Parser:  PlainText,
+	}
+}
+
+// Resolve calls the http endpoint and parses the IP addresses out of the response.
+// Any extracted value that is not an IP address fails the resolution
+func (h *HTTP) Resolve(ctx context.Context) ([]string, error) {
+	request, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve current public address")
+	}
+	request = request.WithContext(ctx)
+	for k, v := range h.Headers {
+		request.Header.Set(k, v)
+	}
+	if h.Username != "" || h.Password != "" {
+		request.SetBasicAuth(h.Username, h.Password)
+	}
+	response, err := (&http.Client{Timeout: h.Timeout}).Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve current public address")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to resolve current public address, unexpected http code %d from %s. expecting %d", response.StatusCode, h.URL, http.StatusOK)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve current public address, failed to read response")
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("unable to resolve current public address, the response from %s exceeds %d bytes", h.URL, maxResponseSize)
+	}
+	parser := h.Parser
+	if parser == nil {
+		parser = PlainText
+	}
+	values, err := parser(body)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to resolve current public address from %s", h.URL))
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("unable to resolve current public address, no address found in response from %s", h.URL)
+	}
+	ips := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if net.ParseIP(value) == nil {
+			return nil, fmt.Errorf("unable to resolve current public address, '%s' from %s is not an IP address", value, h.URL)
+		}
+		ips = append(ips, value)
+	}
+	return ips, nil
+}
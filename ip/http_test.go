@@ -0,0 +1,123 @@
+package ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		body     string
+		expected []string
+		err      bool
+	}{
+		{name: "plain text", parser: PlainText, body: "203.0.113.1\n", expected: []string{"203.0.113.1"}},
+		{name: "plain text list", parser: PlainText, body: "203.0.113.1, 2001:db8::1\n203.0.113.2", expected: []string{"203.0.113.1", "2001:db8::1", "203.0.113.2"}},
+		{name: "json key", parser: JSONPath("ip"), body: `{"ip": "203.0.113.1"}`, expected: []string{"203.0.113.1"}},
+		{name: "json nested", parser: JSONPath("$.data.addresses[1]"), body: `{"data": {"addresses": ["203.0.113.1", "203.0.113.2"]}}`, expected: []string{"203.0.113.2"}},
+		{name: "json list", parser: JSONPath("data.addresses"), body: `{"data": {"addresses": ["203.0.113.1", "203.0.113.2"]}}`, expected: []string{"203.0.113.1", "203.0.113.2"}},
+		{name: "json missing", parser: JSONPath("data.ip"), body: `{"data": "203.0.113.1"}`, err: true},
+		{name: "json not string", parser: JSONPath("ip"), body: `{"ip": 12}`, err: true},
+		{name: "json bad index", parser: JSONPath("ips.2"), body: `{"ips": ["203.0.113.1"]}`, err: true},
+		{name: "not json", parser: JSONPath("ip"), body: `<html></html>`, err: true},
+		{name: "regexp", parser: Regexp(regexp.MustCompile(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`)), body: "<td>203.0.113.1</td>", expected: []string{"203.0.113.1"}},
+		{name: "regexp group", parser: Regexp(regexp.MustCompile(`WAN: ([^<]+)<`)), body: "<td>LAN: 192.168.1.1</td><td>WAN: 203.0.113.1</td>", expected: []string{"203.0.113.1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := test.parser([]byte(test.body))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, values)
+			}
+		})
+	}
+}
+
+type testHTTPHandler struct {
+	response string
+	headers  http.Header
+	username string
+	password string
+	delay    time.Duration
+}
+
+func (t *testHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.headers = r.Header
+	t.username, t.password, _ = r.BasicAuth()
+	time.Sleep(t.delay)
+	w.Write([]byte(t.response))
+}
+
+func TestResolveHTTP(t *testing.T) {
+	h := &testHTTPHandler{response: "203.0.113.1"}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	ips, err := r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, ips)
+	assert.Equal(t, "", h.username)
+
+	r.Headers["X-Test"] = "value"
+	r.Username = "user"
+	r.Password = "secret"
+	r.Parser = JSONPath("address")
+	h.response = `{"address": " 2001:db8::1 "}`
+	ips, err = r.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::1"}, ips)
+	assert.Equal(t, "value", h.headers.Get("X-Test"))
+	assert.Equal(t, "user", h.username)
+	assert.Equal(t, "secret", h.password)
+}
+
+func TestResolveHTTPErrors(t *testing.T) {
+	h := &testHTTPHandler{response: "<html><script>alert()</script></html>"}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	ips, err := r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "not an IP address")
+
+	h.response = ""
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "no address")
+
+	h.response = "203.0.113.1"
+	r.Parser = JSONPath("ip")
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+
+	r.Parser = PlainText
+	h.response = strings.Repeat("203.0.113.1\n", maxResponseSize/12+1)
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "exceeds")
+
+	h.response = "203.0.113.1"
+	r.Timeout = 10 * time.Millisecond
+	h.delay = 100 * time.Millisecond
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+}
@@ -1,9 +1,11 @@
 package ip
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -11,9 +13,14 @@ import (
 // IPifyURL is the default address of the ipify service
 const IPifyURL = "https://api.ipify.org?format=json"
 
+// IPifyTimeout is the default maximum duration of a call to the ipify service
+const IPifyTimeout = 10 * time.Second
+
 // IPify implements a resolver that uses ipify.org to resolve the public IP
 type IPify struct {
 	URL string
+	// Timeout is the maximum duration of a call, no timeout is applied when zero
+	Timeout time.Duration
 }
 
 // IP is the structure in which the ip address is de-serialized
@@ -24,13 +31,23 @@ type IP struct {
 // NewIPify instanciates a new IP address resolver with default address
 func NewIPify() *IPify {
 	return &IPify{
-		URL: IPifyURL,
+		URL:     IPifyURL,
+		Timeout: IPifyTimeout,
 	}
 }
 
 // Resolve calls ipify api to get the apparent public address
-func (i *IPify) Resolve() ([]string, error) {
-	response, err := http.Get(i.URL)
+func (i *IPify) Resolve(ctx context.Context) ([]string, error) {
+	if i.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.Timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequest(http.MethodGet, i.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve current public address")
+	}
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to resolve current public address")
 	}
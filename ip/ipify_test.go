@@ -1,10 +1,12 @@
 package ip
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,16 +14,18 @@ import (
 type testHandler struct {
 	responseCode int
 	response     string
+	delay        time.Duration
 }
 
 func (t *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(t.delay)
 	w.WriteHeader(t.responseCode)
 	w.Write([]byte(t.response))
 }
 
 func TestResolveIPIFY(t *testing.T) {
 	r := NewIPify()
-	ips, err := r.Resolve()
+	ips, err := r.Resolve(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, ips)
 	assert.Equal(t, 1, len(ips))
@@ -30,19 +34,18 @@ func TestResolveIPIFY(t *testing.T) {
 
 func TestResolveErrors(t *testing.T) {
 	r := IPify{URL: "file:///tmp/this/file/should/not/exist"}
-	ips, err := r.Resolve()
+	ips, err := r.Resolve(context.Background())
 	assert.Error(t, err)
 	assert.Nil(t, ips)
 
 	h := &testHandler{
-		http.StatusCreated,
-		"",
+		responseCode: http.StatusCreated,
 	}
 	s := httptest.NewServer(h)
 	defer s.Close()
 
 	r = IPify{URL: s.URL}
-	ips, err = r.Resolve()
+	ips, err = r.Resolve(context.Background())
 	assert.Error(t, err)
 	assert.Nil(t, ips)
 	assert.Contains(t, err.Error(), "200")
@@ -50,8 +53,14 @@ func TestResolveErrors(t *testing.T) {
 
 	h.responseCode = http.StatusOK
 	h.response = "something not json"
-	ips, err = r.Resolve()
+	ips, err = r.Resolve(context.Background())
 	assert.Error(t, err)
 	assert.Nil(t, ips)
 
+	h.response = `{"ip": "203.0.113.1"}`
+	h.delay = 100 * time.Millisecond
+	r.Timeout = 10 * time.Millisecond
+	ips, err = r.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
 }
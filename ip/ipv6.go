@@ -0,0 +1,111 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// interfaceAddrs returns the addresses of a local interface
+var interfaceAddrs = func(name string) ([]net.Addr, error) {
+	i, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return i.Addrs()
+}
+
+var uniqueLocal = mustParseNetworks("fc00::/7")[0]
+
+func isGlobalIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() && !uniqueLocal.Contains(ip)
+}
+
+// IPv6Prefix learns the IPv6 prefix currently delegated to the network
+type IPv6Prefix struct {
+	// Interface is the local interface whose global IPv6 address is in the prefix
+	Interface string
+	// Resolver is used when Interface is empty, and must resolve one global IPv6 address in the prefix
+	Resolver Resolver
+	// Length is the length of the prefix, defaults to 64
+	Length int
+}
+
+func (p *IPv6Prefix) address(ctx context.Context) (net.IP, error) {
+	if p.Interface != "" {
+		addrs, err := interfaceAddrs(p.Interface)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("unable to get addresses of interface %s", p.Interface))
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && isGlobalIPv6(n.IP) {
+				return n.IP, nil
+			}
+		}
+		return nil, fmt.Errorf("no global IPv6 address found on interface %s", p.Interface)
+	}
+	if p.Resolver == nil {
+		return nil, fmt.Errorf("either an interface or a resolver is required to learn the IPv6 prefix")
+	}
+	ips, err := p.Resolver.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if address := net.ParseIP(ip); isGlobalIPv6(address) {
+			return address, nil
+		}
+	}
+	return nil, fmt.Errorf("no global IPv6 address found in [%s]", strings.Join(ips, ", "))
+}
+
+// Prefix returns the currently delegated prefix
+func (p *IPv6Prefix) Prefix(ctx context.Context) (*net.IPNet, error) {
+	address, err := p.address(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to learn the IPv6 prefix")
+	}
+	length := p.Length
+	if length == 0 {
+		length = 64
+	}
+	mask := net.CIDRMask(length, 8*net.IPv6len)
+	return &net.IPNet{IP: address.Mask(mask), Mask: mask}, nil
+}
+
+// Host returns a resolver of the address of the host with interface identifier id, e.g. ::10, in the current prefix
+func (p *IPv6Prefix) Host(id string) (*IPv6Host, error) {
+	ip := net.ParseIP(id)
+	if ip == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("invalid interface identifier %s, expecting an IPv6 address such as ::10", id)
+	}
+	return &IPv6Host{Prefix: p, ID: ip}, nil
+}
+
+// IPv6Host is a resolver of the address of a host with a stable interface identifier in a changing prefix
+type IPv6Host struct {
+	Prefix *IPv6Prefix
+	// ID is the interface identifier of the host, its bits in the prefix are ignored
+	ID net.IP
+}
+
+// Resolve implements the Resolver interface
+func (h *IPv6Host) Resolve(ctx context.Context) ([]string, error) {
+	prefix, err := h.Prefix.Prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []string{h.Address(prefix)}, nil
+}
+
+// Address returns the address of the host in prefix, an IPv6 network
+func (h *IPv6Host) Address(prefix *net.IPNet) string {
+	address := make(net.IP, net.IPv6len)
+	for i := range address {
+		address[i] = prefix.IP[i] | (h.ID[i] &^ prefix.Mask[i])
+	}
+	return address.String()
+}
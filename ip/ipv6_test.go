@@ -0,0 +1,98 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPv6PrefixResolver(t *testing.T) {
+	p := IPv6Prefix{Resolver: &Static{[]string{"203.0.113.1", "2001:db8:1:2:aaaa:bbbb:cccc:dddd"}}}
+	prefix, err := p.Prefix(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:1:2::/64", prefix.String())
+
+	p.Length = 56
+	prefix, err = p.Prefix(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:1::/56", prefix.String())
+
+	p.Resolver = &Static{[]string{"203.0.113.1", "fd00::1", "fe80::1"}}
+	_, err = p.Prefix(context.Background())
+	assert.Error(t, err)
+
+	p.Resolver = nil
+	_, err = p.Prefix(context.Background())
+	assert.Error(t, err)
+}
+
+func TestIPv6PrefixInterface(t *testing.T) {
+	defer func(f func(string) ([]net.Addr, error)) { interfaceAddrs = f }(interfaceAddrs)
+	addrs := map[string][]net.Addr{
+		"eth0": {
+			&net.IPNet{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("2001:db8:5:6::2"), Mask: net.CIDRMask(64, 128)},
+		},
+		"eth1": {
+			&net.IPNet{IP: net.ParseIP("192.168.1.2"), Mask: net.CIDRMask(24, 32)},
+		},
+	}
+	interfaceAddrs = func(name string) ([]net.Addr, error) {
+		a, ok := addrs[name]
+		if !ok {
+			return nil, fmt.Errorf("no such interface")
+		}
+		return a, nil
+	}
+
+	p := IPv6Prefix{Interface: "eth0"}
+	prefix, err := p.Prefix(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:5:6::/64", prefix.String())
+
+	p.Interface = "eth1"
+	_, err = p.Prefix(context.Background())
+	assert.Error(t, err)
+
+	p.Interface = "eth2"
+	_, err = p.Prefix(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "eth2")
+}
+
+func TestIPv6Host(t *testing.T) {
+	r := &Static{[]string{"2001:db8:1:2::1"}}
+	p := &IPv6Prefix{Resolver: r}
+
+	_, err := p.Host("10.0.0.1")
+	assert.Error(t, err)
+	_, err = p.Host("not an address")
+	assert.Error(t, err)
+
+	h, err := p.Host("::10")
+	assert.NoError(t, err)
+	ips, err := h.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8:1:2::10"}, ips)
+
+	h, err = p.Host("ffff:ffff:ffff:ffff:0:0:0:20")
+	assert.NoError(t, err)
+	r.IPs = []string{"2001:db8:1:3::1"}
+	ips, err = h.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8:1:3::20"}, ips)
+
+	r.IPs = []string{}
+	ips, err = h.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+
+	_, prefix, err := net.ParseCIDR("2001:db8:1:4::/64")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:1:4::20", h.Address(prefix))
+}
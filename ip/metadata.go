@@ -0,0 +1,190 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataURL is the default address of cloud instance metadata services
+const MetadataURL = "http://169.254.169.254"
+
+// Clouds supported by the Metadata resolver
+const (
+	CloudEC2          = "ec2"
+	CloudGCE          = "gce"
+	CloudAzure        = "azure"
+	CloudHetzner      = "hetzner"
+	CloudDigitalOcean = "digitalocean"
+)
+
+// ec2TokenTTL is the lifetime requested for IMDSv2 session tokens, in seconds
+const ec2TokenTTL = 21600
+
+// ec2TokenRenewal is how long before their expiry IMDSv2 session tokens are renewed
+const ec2TokenRenewal = time.Minute
+
+// metadataBackend describes how to get the public IP from a cloud metadata service
+type metadataBackend struct {
+	// path is the path of the public IP document, relative to the metadata service URL
+	path string
+	// headers are the static headers the metadata service requires
+	headers map[string]string
+	// token optionally returns session headers to be added to the request
+	token func(ctx context.Context, m *Metadata) (map[string]string, error)
+}
+
+var metadataBackends = map[string]metadataBackend{
+	CloudEC2: {
+		path:  "/latest/meta-data/public-ipv4",
+		token: ec2Token,
+	},
+	CloudGCE: {
+		path:    "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+		headers: map[string]string{"Metadata-Flavor": "Google"},
+	},
+	CloudAzure: {
+		path:    "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=2017-08-01&format=text",
+		headers: map[string]string{"Metadata": "true"},
+	},
+	CloudHetzner: {
+		path: "/hetzner/v1/metadata/public-ipv4",
+	},
+	CloudDigitalOcean: {
+		path: "/metadata/v1/interfaces/public/0/ipv4/address",
+	},
+}
+
+// MetadataClouds lists the clouds supported by the Metadata resolver, in auto-detection order
+var MetadataClouds = []string{CloudEC2, CloudGCE, CloudAzure, CloudDigitalOcean, CloudHetzner}
+
+// Metadata implements a resolver that reads the public IP of a cloud instance
+// from the cloud provider instance metadata service
+type Metadata struct {
+	// Cloud is the cloud provider to query, one of MetadataClouds.
+	// When empty, the cloud is auto-detected on the first successful resolution
+	Cloud string
+	// URL is the address of the metadata service
+	URL string
+	// Client is the http client used to reach the metadata service
+	Client *http.Client
+
+	// token is the last IMDSv2 session token, reused until tokenExpiry
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewMetadata instanciates a new cloud metadata IP address resolver with default address.
+// An empty cloud enables auto-detection
+func NewMetadata(cloud string) (*Metadata, error) {
+	if _, ok := metadataBackends[cloud]; cloud != "" && !ok {
+		return nil, fmt.Errorf("unknown cloud %s, expecting one of %s", cloud, strings.Join(MetadataClouds, ", "))
+	}
+	return &Metadata{
+		Cloud: cloud,
+		URL:   MetadataURL,
+		Client: &http.Client{
+			Timeout: 2 * time.Second,
+		},
+	}, nil
+}
+
+// ec2Token returns the IMDSv2 session token header, the token is requested again shortly before it expires
+func ec2Token(ctx context.Context, m *Metadata) (map[string]string, error) {
+	if m.token != "" && time.Now().Before(m.tokenExpiry) {
+		return map[string]string{"X-aws-ec2-metadata-token": m.token}, nil
+	}
+	requested := time.Now()
+	request, err := http.NewRequest(http.MethodPut, m.URL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build ec2 metadata token request")
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", fmt.Sprintf("%d", ec2TokenTTL))
+	token, err := m.get(request.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get ec2 metadata session token")
+	}
+	m.token = token
+	m.tokenExpiry = requested.Add(ec2TokenTTL*time.Second - ec2TokenRenewal)
+	return map[string]string{"X-aws-ec2-metadata-token": token}, nil
+}
+
+func (m *Metadata) client() *http.Client {
+	if m.Client == nil {
+		return http.DefaultClient
+	}
+	return m.Client
+}
+
+func (m *Metadata) get(request *http.Request) (string, error) {
+	response, err := m.client().Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected http code %d from %s. expecting %d", response.StatusCode, request.URL, http.StatusOK)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxResponseSize {
+		return "", fmt.Errorf("the response from %s exceeds %d bytes", request.URL, maxResponseSize)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (m *Metadata) resolve(ctx context.Context, cloud string) ([]string, error) {
+	backend := metadataBackends[cloud]
+	request, err := http.NewRequest(http.MethodGet, m.URL+backend.path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to build %s metadata request", cloud))
+	}
+	for k, v := range backend.headers {
+		request.Header.Set(k, v)
+	}
+	if backend.token != nil {
+		headers, err := backend.token(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+	}
+	address, err := m.get(request.WithContext(ctx))
+	if err != nil {
+		// the session token may have been revoked, a new one is requested at the next resolution
+		m.token = ""
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to resolve current public address from %s metadata", cloud))
+	}
+	if net.ParseIP(address) == nil {
+		return nil, fmt.Errorf("unable to resolve current public address from %s metadata, '%s' is not an IP address", cloud, address)
+	}
+	return []string{address}, nil
+}
+
+// Resolve queries the cloud metadata service to get the public address of the instance
+func (m *Metadata) Resolve(ctx context.Context) ([]string, error) {
+	if m.Cloud != "" {
+		return m.resolve(ctx, m.Cloud)
+	}
+	errs := []string{}
+	for _, cloud := range MetadataClouds {
+		ips, err := m.resolve(ctx, cloud)
+		if err == nil {
+			m.Cloud = cloud
+			return ips, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("unable to detect the cloud provider from metadata: [%s]", strings.Join(errs, "; "))
+}
@@ -0,0 +1,158 @@
+package ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMetadataHandler struct {
+	cloud    string
+	address  string
+	requests []string
+}
+
+func (t *testMetadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.requests = append(t.requests, r.Method+" "+r.URL.Path)
+	switch t.cloud {
+	case CloudEC2:
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" && r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") != "" {
+			w.Write([]byte("test-token"))
+			return
+		}
+		if r.URL.Path == "/latest/meta-data/public-ipv4" && r.Header.Get("X-aws-ec2-metadata-token") == "test-token" {
+			w.Write([]byte(t.address))
+			return
+		}
+	case CloudGCE:
+		if r.URL.Path == "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip" && r.Header.Get("Metadata-Flavor") == "Google" {
+			w.Write([]byte(t.address))
+			return
+		}
+	case CloudAzure:
+		if r.URL.Path == "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress" && r.Header.Get("Metadata") == "true" && r.URL.Query().Get("format") == "text" {
+			w.Write([]byte(t.address))
+			return
+		}
+	case CloudHetzner:
+		if r.URL.Path == "/hetzner/v1/metadata/public-ipv4" {
+			w.Write([]byte(t.address))
+			return
+		}
+	case CloudDigitalOcean:
+		if r.URL.Path == "/metadata/v1/interfaces/public/0/ipv4/address" {
+			w.Write([]byte(t.address + "\n"))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestNewMetadata(t *testing.T) {
+	m, err := NewMetadata("")
+	assert.NoError(t, err)
+	assert.Equal(t, MetadataURL, m.URL)
+	assert.Equal(t, "", m.Cloud)
+
+	m, err = NewMetadata(CloudGCE)
+	assert.NoError(t, err)
+	assert.Equal(t, CloudGCE, m.Cloud)
+
+	m, err = NewMetadata("unknown")
+	assert.Error(t, err)
+	assert.Nil(t, m)
+}
+
+func TestResolveMetadata(t *testing.T) {
+	for _, cloud := range MetadataClouds {
+		t.Run(cloud, func(t *testing.T) {
+			h := &testMetadataHandler{cloud: cloud, address: "203.0.113.12"}
+			s := httptest.NewServer(h)
+			defer s.Close()
+
+			m := Metadata{Cloud: cloud, URL: s.URL}
+			ips, err := m.Resolve(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"203.0.113.12"}, ips)
+
+			m = Metadata{URL: s.URL}
+			ips, err = m.Resolve(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"203.0.113.12"}, ips)
+			assert.Equal(t, cloud, m.Cloud)
+		})
+	}
+}
+
+func TestResolveMetadataEC2Token(t *testing.T) {
+	h := &testMetadataHandler{cloud: CloudEC2, address: "203.0.113.12"}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	m := Metadata{Cloud: CloudEC2, URL: s.URL}
+	_, err := m.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PUT /latest/api/token", "GET /latest/meta-data/public-ipv4"}, h.requests)
+
+	// the token is reused until it is about to expire
+	_, err = m.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /latest/meta-data/public-ipv4"}, h.requests[2:])
+	assert.True(t, m.tokenExpiry.After(time.Now().Add(5*time.Hour)))
+
+	m.tokenExpiry = time.Now()
+	_, err = m.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PUT /latest/api/token", "GET /latest/meta-data/public-ipv4"}, h.requests[3:])
+
+	// a rejected token is requested again
+	m.token = "revoked"
+	_, err = m.Resolve(context.Background())
+	assert.Error(t, err)
+	_, err = m.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /latest/meta-data/public-ipv4", "PUT /latest/api/token", "GET /latest/meta-data/public-ipv4"}, h.requests[5:])
+}
+
+func TestResolveMetadataResponseSize(t *testing.T) {
+	h := &testMetadataHandler{cloud: CloudHetzner, address: strings.Repeat("1", maxResponseSize+1)}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	m := Metadata{Cloud: CloudHetzner, URL: s.URL}
+	ips, err := m.Resolve(context.Background())
+	assert.Nil(t, ips)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds")
+}
+
+func TestResolveMetadataErrors(t *testing.T) {
+	h := &testMetadataHandler{cloud: CloudGCE, address: "<html>not an ip</html>"}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	m := Metadata{Cloud: CloudGCE, URL: s.URL}
+	ips, err := m.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "not an IP address")
+
+	m = Metadata{Cloud: CloudAzure, URL: s.URL}
+	ips, err = m.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "404")
+
+	h.cloud = ""
+	m = Metadata{URL: s.URL}
+	ips, err = m.Resolve(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, ips)
+	assert.Contains(t, err.Error(), "detect")
+	assert.Equal(t, "", m.Cloud)
+}
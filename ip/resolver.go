@@ -1,7 +1,12 @@
 package ip
 
+import (
+	"context"
+)
+
 // Resolver defines methods an object must implement to be an IP resolver
 type Resolver interface {
-	// Resolve resolves the IPs the DNS should resolve
-	Resolve() ([]string, error)
+	// Resolve resolves the IPs the DNS should resolve.
+	// ctx is done when the poll times out, the listener keeps the last IPs when resolution fails
+	Resolve(ctx context.Context) ([]string, error)
 }
@@ -1,11 +1,15 @@
 package ip
 
+import (
+	"context"
+)
+
 // Static is a resolver that have static IPs
 type Static struct {
 	IPs []string
 }
 
 // Resolve implements the Resolver interface
-func (s *Static) Resolve() ([]string, error) {
+func (s *Static) Resolve(ctx context.Context) ([]string, error) {
 	return s.IPs, nil
 }
@@ -1,6 +1,7 @@
 package ip
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,7 +9,7 @@ import (
 
 func TestResolveStatic(t *testing.T) {
 	s := Static{[]string{"127.0.0.1"}}
-	ips, err := s.Resolve()
+	ips, err := s.Resolve(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"127.0.0.1"}, ips)
 
@@ -18,7 +19,7 @@ func TestResolveStatic(t *testing.T) {
 		{"2001:0db8:0000:85a3:0000:0000:ac1f:8001", "2000:0:0:0:0:0:0:0", "129.168.1.1", "169.0.0.1"},
 	} {
 		s.IPs = expectedIPs
-		ips, err = s.Resolve()
+		ips, err = s.Resolve(context.Background())
 		assert.NoError(t, err)
 		assert.Equal(t, expectedIPs, ips)
 	}
@@ -0,0 +1,232 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cause is the event that caused a change of the records
+type Cause string
+
+const (
+	// IPChanged is the cause of the updates of listed domains when the IPs change
+	IPChanged Cause = "ip-changed"
+	// DomainAdded is the cause of the updates of domains added to the list of domains
+	DomainAdded Cause = "domain-added"
+	// DomainRemoved is the cause of the removal of the records of domains that are no longer listed
+	DomainRemoved Cause = "domain-removed"
+	// Drift is the cause of the repair of records that differ from the expected IPs
+	Drift Cause = "drift"
+	// Rollback is the cause of the changes made by Rollback
+	Rollback Cause = "rollback"
+)
+
+// Entry is a change applied to the records of a domain
+type Entry struct {
+	// ID identifies the entry in the journal, ids are increasing from 1
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+	// Owner is the name of the updater that applied the change
+	Owner  string `json:"owner,omitempty"`
+	Domain string `json:"domain"`
+	// Previous are the values of the records before the change, empty when unknown
+	Previous []string `json:"previous,omitempty"`
+	// IPs are the values of the records after the change
+	IPs []string `json:"ips,omitempty"`
+	// Removed is set when the records were removed
+	Removed bool  `json:"removed,omitempty"`
+	Cause   Cause `json:"cause"`
+	// Attempt is the number of retries the change took
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Journal appends the changes applied to the records to a file, one JSON entry per line.
+// It can be shared by several updaters
+type Journal struct {
+	path string
+	lock sync.Mutex
+	id   int64
+	// last are the values of the records after the last change of each domain, by provider
+	last map[string]map[string][]string
+}
+
+// Open reads the journal at path to resume it, the file is created on the first change
+func Open(path string) (*Journal, error) {
+	entries, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, last: map[string]map[string][]string{}}
+	for _, entry := range entries {
+		j.remember(entry)
+	}
+	return j, nil
+}
+
+func (j *Journal) remember(entry Entry) {
+	if entry.ID > j.id {
+		j.id = entry.ID
+	}
+	if j.last[entry.Provider] == nil {
+		j.last[entry.Provider] = map[string][]string{}
+	}
+	j.last[entry.Provider][entry.Domain] = entry.IPs
+}
+
+// Append assigns the next id to entry and writes it at the end of the journal.
+// Its time defaults to now, and its previous values to the values of the last change of its domain
+func (j *Journal) Append(entry Entry) (Entry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entry.ID = j.id + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Previous == nil {
+		entry.Previous = j.last[entry.Provider][entry.Domain]
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, errors.Wrap(err, "unable to serialize the journal entry")
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return entry, errors.Wrap(err, fmt.Sprintf("unable to write the journal %s", j.path))
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return entry, errors.Wrap(err, fmt.Sprintf("unable to write the journal %s", j.path))
+	}
+	j.remember(entry)
+	return entry, nil
+}
+
+// Entries returns all the entries of the journal, in order
+func (j *Journal) Entries() ([]Entry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return Read(j.path)
+}
+
+// Read returns the entries of the journal at path, in order. No entry is returned when the file does not exist
+func Read(path string) ([]Entry, error) {
+	entries := []Entry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to read the journal %s", path))
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, fmt.Sprintf("unable to read the journal %s", path))
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			entry := Entry{}
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				return nil, errors.Wrap(jsonErr, fmt.Sprintf("unable to parse the journal %s at line %d", path, n))
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+// History returns the entries changing the records of domain, all entries are returned when domain is empty
+func History(entries []Entry, domain string) []Entry {
+	if domain == "" {
+		return entries
+	}
+	history := []Entry{}
+	for _, entry := range entries {
+		if entry.Domain == domain {
+			history = append(history, entry)
+		}
+	}
+	return history
+}
+
+// Until returns the entries applied up to point, which is either an entry id or a time in RFC 3339 format
+func Until(entries []Entry, point string) ([]Entry, error) {
+	until := []Entry{}
+	if id, err := strconv.ParseInt(point, 10, 64); err == nil {
+		found := false
+		for _, entry := range entries {
+			if entry.ID <= id {
+				until = append(until, entry)
+			}
+			found = found || entry.ID == id
+		}
+		if !found {
+			return nil, fmt.Errorf("no entry %d in the journal", id)
+		}
+		return until, nil
+	}
+	t, err := time.Parse(time.RFC3339, point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid point %s, expecting an entry id or a time in RFC 3339 format, e.g. 2019-07-04T10:00:00Z", point)
+	}
+	for _, entry := range entries {
+		if !entry.Time.After(t) {
+			until = append(until, entry)
+		}
+	}
+	return until, nil
+}
+
+// Targets returns the last entry of each domain of provider
+func Targets(entries []Entry, provider string) map[string]Entry {
+	targets := map[string]Entry{}
+	for _, entry := range entries {
+		if entry.Provider == provider {
+			targets[entry.Domain] = entry
+		}
+	}
+	return targets
+}
+
+// domains returns the sorted domains of targets
+func domains(targets map[string]Entry) []string {
+	names := []string{}
+	for domain := range targets {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
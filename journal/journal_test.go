@@ -0,0 +1,93 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mohotani-journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+
+	j, err := Open(path)
+	assert.NoError(t, err)
+	entries, err := j.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{}, entries)
+
+	first := time.Date(2019, 7, 2, 10, 0, 0, 0, time.UTC)
+	entry, err := j.Append(Entry{Time: first, Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Cause: DomainAdded})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), entry.ID)
+	assert.Nil(t, entry.Previous)
+	_, err = j.Append(Entry{Provider: "route53", Domain: "www.example.com", IPs: []string{"203.0.113.9"}, Cause: DomainAdded})
+	assert.NoError(t, err)
+
+	// a journal opened again resumes the ids and the previous values
+	j, err = Open(path)
+	assert.NoError(t, err)
+	entry, err = j.Append(Entry{Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.2"}, Cause: IPChanged})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), entry.ID)
+	assert.False(t, entry.Time.IsZero())
+	assert.Equal(t, []string{"203.0.113.1"}, entry.Previous)
+	entry, err = j.Append(Entry{Provider: "gandi", Domain: "www.example.com", Previous: []string{"203.0.113.3"}, IPs: []string{"203.0.113.2"}, Cause: Drift})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.3"}, entry.Previous)
+
+	entries, err = Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, Entry{ID: 1, Time: first, Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Cause: DomainAdded}, entries[0])
+	assert.True(t, entry.Time.Equal(entries[3].Time))
+	entry.Time = entries[3].Time
+	assert.Equal(t, entry, entries[3])
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"id":1}`+"\n\nnot json\n"), 0600))
+	_, err = Open(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "at line 3")
+
+	j, err = Open(filepath.Join(dir, "missing", "journal.jsonl"))
+	assert.NoError(t, err)
+	_, err = j.Append(Entry{Domain: "www.example.com"})
+	assert.Error(t, err)
+}
+
+func TestHistoryAndUntil(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2019, 7, 2, hour, 0, 0, 0, time.UTC)
+	}
+	entries := []Entry{
+		{ID: 1, Time: at(10), Provider: "gandi", Domain: "www.example.com", IPs: []string{"203.0.113.1"}},
+		{ID: 2, Time: at(11), Provider: "gandi", Domain: "www2.example.com", IPs: []string{"203.0.113.1"}},
+		{ID: 3, Time: at(12), Provider: "route53", Domain: "www.example.com", IPs: []string{"203.0.113.9"}},
+		{ID: 4, Time: at(13), Provider: "gandi", Domain: "www.example.com", IPs: []string{"203.0.113.2"}},
+	}
+	assert.Equal(t, entries, History(entries, ""))
+	assert.Equal(t, []Entry{entries[0], entries[2], entries[3]}, History(entries, "www.example.com"))
+	assert.Equal(t, []Entry{}, History(entries, "www3.example.com"))
+
+	until, err := Until(entries, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, entries[:2], until)
+	until, err = Until(entries, "2019-07-02T12:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, entries[:3], until)
+	until, err = Until(entries, "2019-07-02T08:00:00+02:00")
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{}, until)
+	_, err = Until(entries, "5")
+	assert.EqualError(t, err, "no entry 5 in the journal")
+	_, err = Until(entries, "last tuesday")
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]Entry{"www.example.com": entries[3], "www2.example.com": entries[1]}, Targets(entries, "gandi"))
+}
@@ -0,0 +1,82 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tjamet/mohotani/dns/provider"
+	"github.com/tjamet/mohotani/state"
+)
+
+// Rollback applies again through updater the records of the domains of the named provider as they were at point,
+// an entry id or a time in RFC 3339 format. Each provider call is limited to timeout, no timeout is applied when zero.
+// Records removed at point are removed again when updater implements provider.Remover, as well as the records
+// of an address family without values at point. Records of domains that were not changed yet at point are left in place.
+// The changes are journaled with the Rollback cause and recorded in registry when not nil, so that the records
+// are not considered up to date with their values before the rollback. They are returned, along with the errors of the domains that failed
+func (j *Journal) Rollback(ctx context.Context, updater provider.Updater, registry *state.Registry, name, point string, timeout time.Duration) ([]Entry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	until, err := Until(entries, point)
+	if err != nil {
+		return nil, err
+	}
+	current := Targets(entries, name)
+	targets := Targets(until, name)
+	applied := []Entry{}
+	messages := []string{}
+	for _, domain := range domains(current) {
+		target, ok := targets[domain]
+		if !ok || target.Removed == current[domain].Removed && sameValues(target.IPs, current[domain].IPs) {
+			continue
+		}
+		entry := Entry{Provider: name, Owner: target.Owner, Domain: domain, IPs: target.IPs, Removed: target.Removed, Cause: Rollback}
+		if err := rollback(ctx, updater, entry, current[domain].IPs, timeout); err != nil {
+			messages = append(messages, fmt.Sprintf("unable to roll back the records of %s: %s", domain, err.Error()))
+			continue
+		}
+		if registry != nil && entry.Removed {
+			registry.Delete(name, domain)
+		} else if registry != nil {
+			registry.Set(name, domain, state.Record{IPs: entry.IPs, Owner: entry.Owner, Updated: time.Now()})
+		}
+		entry, err = j.Append(entry)
+		if err != nil {
+			messages = append(messages, err.Error())
+			continue
+		}
+		applied = append(applied, entry)
+	}
+	if len(messages) == 0 {
+		return applied, nil
+	}
+	return applied, fmt.Errorf("%s", strings.Join(messages, ", "))
+}
+
+// rollback applies the records of entry through updater, removing the values of previous that are no longer set
+// when updater implements provider.Remover
+func rollback(ctx context.Context, updater provider.Updater, entry Entry, previous []string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	remover, removable := updater.(provider.Remover)
+	if entry.Removed {
+		if !removable {
+			return fmt.Errorf("the DNS provider can not remove records")
+		}
+		return remover.Remove(ctx, entry.Domain, previous...)
+	}
+	if err := updater.Update(ctx, entry.Domain, entry.IPs...); err != nil {
+		return err
+	}
+	if stale := provider.Vanished(previous, entry.IPs); removable && len(stale) > 0 {
+		return remover.Remove(ctx, entry.Domain, stale...)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/state"
+)
+
+type testUpdater struct {
+	calls []string
+	err   error
+}
+
+func (u *testUpdater) Update(ctx context.Context, domain string, ips ...string) error {
+	u.calls = append(u.calls, fmt.Sprintf("%s=[%s]", domain, strings.Join(ips, ",")))
+	return u.err
+}
+
+type testRemover struct {
+	testUpdater
+}
+
+func (u *testRemover) Remove(ctx context.Context, domain string, ips ...string) error {
+	u.calls = append(u.calls, fmt.Sprintf("remove %s=[%s]", domain, strings.Join(ips, ",")))
+	return u.err
+}
+
+// sortedDomains returns the domains of records in alphabetical order
+func sortedDomains(records map[string]state.Record) []string {
+	domains := []string{}
+	for domain := range records {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func TestRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mohotani-journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	j, err := Open(filepath.Join(dir, "journal.jsonl"))
+	assert.NoError(t, err)
+	at := func(hour int) time.Time {
+		return time.Date(2019, 7, 2, hour, 0, 0, 0, time.UTC)
+	}
+	for _, entry := range []Entry{
+		{Time: at(10), Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Cause: DomainAdded},
+		{Time: at(10), Provider: "gandi", Owner: "mohotani", Domain: "www2.example.com", IPs: []string{"203.0.113.1"}, Cause: DomainAdded},
+		{Time: at(10), Provider: "gandi", Owner: "mohotani", Domain: "www3.example.com", IPs: []string{"203.0.113.1"}, Cause: DomainAdded},
+		{Time: at(11), Provider: "gandi", Owner: "mohotani", Domain: "www3.example.com", Removed: true, Cause: DomainRemoved},
+		{Time: at(11), Provider: "route53", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.9"}, Cause: DomainAdded},
+		{Time: at(12), Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", IPs: []string{"203.0.113.2"}, Cause: IPChanged},
+		{Time: at(12), Provider: "gandi", Owner: "mohotani", Domain: "www4.example.com", IPs: []string{"203.0.113.2"}, Cause: DomainAdded},
+		{Time: at(13), Provider: "gandi", Owner: "mohotani", Domain: "www2.example.com", Removed: true, Cause: DomainRemoved},
+		{Time: at(13), Provider: "gandi", Owner: "mohotani", Domain: "www3.example.com", IPs: []string{"203.0.113.2"}, Cause: DomainAdded},
+	} {
+		_, err := j.Append(entry)
+		assert.NoError(t, err)
+	}
+	registry, err := state.Open(context.Background(), &state.File{Path: filepath.Join(dir, "state.json")})
+	assert.NoError(t, err)
+	for _, domain := range []string{"www.example.com", "www3.example.com", "www4.example.com"} {
+		registry.Set("gandi", domain, state.Record{IPs: []string{"203.0.113.2"}, Owner: "mohotani"})
+	}
+
+	// the domain added after the point is left in place, the other provider is not changed
+	u := &testRemover{}
+	applied, err := j.Rollback(context.Background(), u, registry, "gandi", "2019-07-02T11:30:00Z", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com=[203.0.113.1]", "www2.example.com=[203.0.113.1]", "remove www3.example.com=[203.0.113.2]"}, u.calls)
+	assert.Equal(t, 3, len(applied))
+	assert.Equal(t, Entry{ID: 10, Time: applied[0].Time, Provider: "gandi", Owner: "mohotani", Domain: "www.example.com", Previous: []string{"203.0.113.2"}, IPs: []string{"203.0.113.1"}, Cause: Rollback}, applied[0])
+	assert.Equal(t, Entry{ID: 12, Time: applied[2].Time, Provider: "gandi", Owner: "mohotani", Domain: "www3.example.com", Previous: []string{"203.0.113.2"}, Removed: true, Cause: Rollback}, applied[2])
+	entries, err := j.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, len(entries))
+	// the state records the rolled back values, so that they are not considered up to date with the previous ones
+	records := registry.Records("gandi", "mohotani")
+	assert.Equal(t, []string{"www.example.com", "www2.example.com", "www4.example.com"}, sortedDomains(records))
+	assert.Equal(t, []string{"203.0.113.1"}, records["www.example.com"].IPs)
+	assert.Equal(t, []string{"203.0.113.1"}, records["www2.example.com"].IPs)
+	assert.Equal(t, []string{"203.0.113.2"}, records["www4.example.com"].IPs)
+
+	// records already matching the point are not applied again
+	u = &testRemover{}
+	applied, err = j.Rollback(context.Background(), u, nil, "gandi", "3", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"www3.example.com=[203.0.113.1]"}, u.calls)
+	assert.Equal(t, 1, len(applied))
+
+	// failures are returned and not journaled
+	failing := &testUpdater{err: fmt.Errorf("test error")}
+	applied, err = j.Rollback(context.Background(), failing, registry, "gandi", "9", 0)
+	assert.EqualError(t, err, strings.Join([]string{
+		"unable to roll back the records of www.example.com: test error",
+		"unable to roll back the records of www2.example.com: the DNS provider can not remove records",
+		"unable to roll back the records of www3.example.com: test error",
+	}, ", "))
+	assert.Equal(t, []Entry{}, applied)
+	assert.Equal(t, []string{"www.example.com=[203.0.113.2]", "www3.example.com=[203.0.113.2]"}, failing.calls)
+	entries, err = j.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, 13, len(entries))
+	assert.Equal(t, []string{"203.0.113.1"}, registry.Records("gandi", "mohotani")["www.example.com"].IPs)
+
+	_, err = j.Rollback(context.Background(), u, nil, "gandi", "42", 0)
+	assert.EqualError(t, err, "no entry 42 in the journal")
+}
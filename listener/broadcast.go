@@ -0,0 +1,80 @@
+package listener
+
+import (
+	"context"
+	"sync"
+)
+
+// Broadcast shares the lists of elements of a Listener between several subscribers, so it is only listened once
+type Broadcast struct {
+	// Listener is the listener whose elements are shared
+	Listener Listener
+
+	lock     sync.Mutex
+	elements []string
+	received bool
+	// changed is closed when a new list is received
+	changed chan struct{}
+}
+
+// wait returns the last list received, if any, and a channel closed when a newer list is received
+func (b *Broadcast) wait() ([]string, bool, <-chan struct{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.elements, b.received, b.changed
+}
+
+// Run listens to Listener until ctx is done, and makes its lists available to the subscribers
+func (b *Broadcast) Run(ctx context.Context) {
+	in := make(chan []string)
+	go b.Listener.Listen(ctx, in)
+	for {
+		select {
+		case elements := <-in:
+			b.lock.Lock()
+			if b.changed != nil {
+				close(b.changed)
+			}
+			b.elements = elements
+			b.received = true
+			b.changed = make(chan struct{})
+			b.lock.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Subscribe returns a listener posting the lists of Listener transformed by f, starting with the last list received.
+// Lists received while the subscriber is busy are coalesced, the lists are not transformed when f is nil
+func (b *Broadcast) Subscribe(f func([]string) []string) Listener {
+	return &subscriber{broadcast: b, transform: f}
+}
+
+type subscriber struct {
+	broadcast *Broadcast
+	transform func([]string) []string
+}
+
+// Listen implements the Listener interface
+func (s *subscriber) Listen(ctx context.Context, out chan []string) {
+	for {
+		elements, received, changed := s.broadcast.wait()
+		if received {
+			if s.transform != nil {
+				elements = s.transform(elements)
+			}
+			if !Send(ctx, out, elements) {
+				return
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expectList(t *testing.T, out chan []string, expected []string) {
+	t.Helper()
+	select {
+	case elements := <-out:
+		assert.Equal(t, expected, elements)
+	case <-time.After(3 * time.Second):
+		t.Errorf("Timeout waiting for %v", expected)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	inner := &testListener{make(chan chan []string)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := &Broadcast{Listener: inner}
+	go b.Run(ctx)
+	in := <-inner.c
+
+	first := make(chan []string)
+	go b.Subscribe(nil).Listen(ctx, first)
+	second := make(chan []string)
+	go b.Subscribe(func(elements []string) []string {
+		return append([]string{"prefix"}, elements...)
+	}).Listen(ctx, second)
+
+	in <- []string{"value 1"}
+	expectList(t, first, []string{"value 1"})
+	expectList(t, second, []string{"prefix", "value 1"})
+
+	// late subscribers start with the last list
+	late := make(chan []string)
+	go b.Subscribe(nil).Listen(ctx, late)
+	expectList(t, late, []string{"value 1"})
+
+	in <- []string{"value 2"}
+	expectList(t, first, []string{"value 2"})
+	expectList(t, second, []string{"prefix", "value 2"})
+	expectList(t, late, []string{"value 2"})
+
+	// the inner listener is only listened once
+	select {
+	case <-inner.c:
+		t.Error("the inner listener was listened several times")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
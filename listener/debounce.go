@@ -0,0 +1,66 @@
+package listener
+
+import (
+	"context"
+	"time"
+)
+
+// DebounceListener forwards the lists of elements of a Listener once they settled.
+// A list is forwarded when no new list was received for Quiet, or at the latest
+// MaxDelay after the first list of a burst, so bursts of changes lead to a single list
+type DebounceListener struct {
+	// Listener is the listener whose elements are debounced
+	Listener Listener
+	// Quiet is the duration without change after which the last list is forwarded, lists are forwarded immediately when zero
+	Quiet time.Duration
+	// MaxDelay is the maximum delay of a list when changes keep coming, lists are only forwarded once quiet when zero
+	MaxDelay time.Duration
+}
+
+// Listen implements the Listener interface and forwards the settled changes to out
+func (d *DebounceListener) Listen(ctx context.Context, out chan []string) {
+	in := make(chan []string)
+	go d.Listener.Listen(ctx, in)
+	var pending []string
+	var quiet, max *time.Timer
+	var quietC, maxC <-chan time.Time
+	stop := func() {
+		for _, t := range []*time.Timer{quiet, max} {
+			if t != nil {
+				t.Stop()
+			}
+		}
+		quiet, max, quietC, maxC = nil, nil, nil, nil
+	}
+	defer stop()
+	for {
+		select {
+		case elements := <-in:
+			if d.Quiet <= 0 {
+				if !Send(ctx, out, elements) {
+					return
+				}
+				continue
+			}
+			pending = elements
+			if quiet != nil {
+				quiet.Stop()
+			}
+			quiet = time.NewTimer(d.Quiet)
+			quietC = quiet.C
+			if max == nil && d.MaxDelay > 0 {
+				max = time.NewTimer(d.MaxDelay)
+				maxC = max.C
+			}
+			continue
+		case <-quietC:
+		case <-maxC:
+		case <-ctx.Done():
+			return
+		}
+		stop()
+		if !Send(ctx, out, pending) {
+			return
+		}
+	}
+}
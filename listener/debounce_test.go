@@ -0,0 +1,83 @@
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebounceListener(t *testing.T) {
+	inner := &testListener{make(chan chan []string)}
+	out := make(chan []string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := &DebounceListener{
+		Listener: inner,
+		Quiet:    50 * time.Millisecond,
+		MaxDelay: 300 * time.Millisecond,
+	}
+	go listener.Listen(ctx, out)
+	in := <-inner.c
+
+	// a burst of changes is forwarded once quiet
+	start := time.Now()
+	in <- []string{"value 1"}
+	in <- []string{"value 1", "value 2"}
+	in <- []string{"value 1", "value 2", "value 3"}
+	select {
+	case out := <-out:
+		assert.Equal(t, []string{"value 1", "value 2", "value 3"}, out)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond, "the list was forwarded before being quiet")
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+	}
+	select {
+	case out := <-out:
+		t.Errorf("An intermediate list %s was forwarded", out)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// changes that keep coming are forwarded after the maximum delay
+	start = time.Now()
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case in <- []string{"value 4"}:
+			case <-stop:
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {
+	case out := <-out:
+		assert.Equal(t, []string{"value 4"}, out)
+		elapsed := time.Since(start)
+		assert.True(t, elapsed >= 300*time.Millisecond, "the list was forwarded after %s, before the maximum delay", elapsed)
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+	}
+	close(stop)
+}
+
+func TestDebounceListenerDisabled(t *testing.T) {
+	inner := &testListener{make(chan chan []string)}
+	out := make(chan []string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go (&DebounceListener{Listener: inner}).Listen(ctx, out)
+	in := <-inner.c
+
+	for _, elements := range [][]string{{"value 1"}, {"value 2"}} {
+		in <- elements
+		select {
+		case out := <-out:
+			assert.Equal(t, elements, out)
+		case <-time.After(3 * time.Second):
+			t.Error("Timeout reading the output channel")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package listener
+
+import (
+	"context"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+// Check defines the interface a function should implement to validate a list of elements
+type Check func([]string) error
+
+// FilterListener forwards the lists of elements of a Listener that pass a check.
+// Rejected lists are logged, counted as poll errors and dropped, keeping the last forwarded list in place
+type FilterListener struct {
+	// Listener is the listener whose elements are checked
+	Listener Listener
+	// Logger is the logger in which rejections will be printed
+	Logger logger.Logger
+	// Check is the function validating each new list of elements
+	Check Check
+	// Name is the name of the listener in metrics, such as ips. Rejections are not counted when empty
+	Name string
+	// Source is the name of the resolution method in metrics, such as ipify or docker
+	Source string
+}
+
+// Listen implements the Listener interface and forwards all valid changes to out
+func (f *FilterListener) Listen(ctx context.Context, out chan []string) {
+	in := make(chan []string)
+	go f.Listener.Listen(ctx, in)
+	for {
+		select {
+		case elements := <-in:
+			err := f.Check(elements)
+			if err != nil {
+				f.Logger.Error("refusing to publish values", logger.F("values", elements), logger.Err(err))
+				if f.Name != "" {
+					pollErrorsTotal.WithLabelValues(f.Name, f.Source).Inc()
+				}
+				continue
+			}
+			if !Send(ctx, out, elements) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+type testListener struct {
+	c chan chan []string
+}
+
+func (l *testListener) Listen(ctx context.Context, c chan []string) {
+	l.c <- c
+}
+
+func TestFilterListener(t *testing.T) {
+	l := &testLogger{
+		make(chan string, 10),
+	}
+	inner := &testListener{make(chan chan []string)}
+	out := make(chan []string)
+	listener := &FilterListener{
+		Listener: inner,
+		Logger:   logger.FromPrintf(l),
+		Check: func(elements []string) error {
+			for _, e := range elements {
+				if e == "invalid" {
+					return fmt.Errorf("invalid element")
+				}
+			}
+			return nil
+		},
+		Name:   "test",
+		Source: "filter",
+	}
+	// the counters outlive the test in the default registry, only their increments are checked
+	pollErrors := testutil.ToFloat64(pollErrorsTotal.WithLabelValues("test", "filter"))
+	go listener.Listen(context.Background(), out)
+	in := <-inner.c
+
+	in <- []string{"value 1"}
+	select {
+	case out := <-out:
+		assert.Equal(t, []string{"value 1"}, out)
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+	}
+
+	in <- []string{"value 1", "invalid"}
+	select {
+	case out := <-out:
+		t.Errorf("An invalid value %s was forwarded", out)
+	case m := <-l.messages:
+		assert.Equal(t, `error: refusing to publish values values="value 1,invalid" error="invalid element"`, m)
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the logger")
+	}
+
+	in <- []string{"value 2"}
+	select {
+	case out := <-out:
+		assert.Equal(t, []string{"value 2"}, out)
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+	}
+	// the rejected list is counted as a poll error
+	assert.Equal(t, pollErrors+1, testutil.ToFloat64(pollErrorsTotal.WithLabelValues("test", "filter")))
+}
@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	"context"
 	"time"
 
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
@@ -8,6 +9,8 @@ import (
 	"k8s.io/client-go/informers/extensions/v1beta1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+
+	"github.com/tjamet/mohotani/listener"
 )
 
 type DomainLister struct {
@@ -26,24 +29,24 @@ func NewDomainLister(c kubernetes.Interface, class string) *DomainLister {
 	}
 }
 
-func (dl *DomainLister) Listen(out chan []string) {
+func (dl *DomainLister) Listen(ctx context.Context, out chan []string) {
 	informer := dl.informer.Informer()
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: dl.handle(out),
+		AddFunc: dl.handle(ctx, out),
 		UpdateFunc: func(old, obj interface{}) {
-			dl.handle(out)(obj)
+			dl.handle(ctx, out)(obj)
 		},
 		DeleteFunc: func(obj interface{}) {
 			if ing, ok := obj.(*extensionsv1beta1.Ingress); ok {
 				delete(dl.ingressHosts, ing.GetSelfLink())
-				dl.notify(out)
+				dl.notify(ctx, out)
 			}
 		},
 	})
-	informer.Run(make(chan struct{}))
+	informer.Run(ctx.Done())
 }
 
-func (dl *DomainLister) handle(out chan []string) func(interface{}) {
+func (dl *DomainLister) handle(ctx context.Context, out chan []string) func(interface{}) {
 	return func(obj interface{}) {
 		if ing, ok := obj.(*extensionsv1beta1.Ingress); ok {
 			if class, ok := ing.Annotations["kubernetes.io/ingress.class"]; ok && class != dl.class {
@@ -57,13 +60,14 @@ func (dl *DomainLister) handle(out chan []string) func(interface{}) {
 				hosts = append(hosts, rule.Host)
 			}
 			dl.ingressHosts[ing.GetSelfLink()] = hosts
-			dl.notify(out)
+			dl.notify(ctx, out)
 
 		}
 	}
 }
 
-func (dl *DomainLister) notify(out chan []string) {
+func (dl *DomainLister) notify(ctx context.Context, out chan []string) {
+	listener.Observe("domains", "k8s", nil)
 	hosts := map[string]interface{}{}
 	for _, ingHosts := range dl.ingressHosts {
 		for _, h := range ingHosts {
@@ -75,6 +79,6 @@ func (dl *DomainLister) notify(out chan []string) {
 		for k := range hosts {
 			uniqueHosts = append(uniqueHosts, k)
 		}
-		out <- uniqueHosts
+		listener.Send(ctx, out, uniqueHosts)
 	}
 }
@@ -0,0 +1,205 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/tjamet/mohotani/listener"
+)
+
+// ServiceIPLister watches the external IPs of a service, typically the LoadBalancer
+// service of the ingress controller
+type ServiceIPLister struct {
+	factory informers.SharedInformerFactory
+	name    string
+	ips     []string
+}
+
+// NewServiceIPLister instanciates a lister watching the service name in namespace
+func NewServiceIPLister(c kubernetes.Interface, namespace, name string) *ServiceIPLister {
+	return &ServiceIPLister{
+		informers.NewSharedInformerFactoryWithOptions(
+			c, 30*time.Second,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			}),
+		),
+		name,
+		nil,
+	}
+}
+
+// Listen implements the Listener interface and posts the service load balancer ingress IPs
+// and external IPs every time they change. An empty list is posted when the service is deleted.
+// Each change of the service is counted as a poll of the k8s.service source in metrics
+func (sl *ServiceIPLister) Listen(ctx context.Context, out chan []string) {
+	informer := sl.factory.Core().V1().Services().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: sl.handle(ctx, out),
+		UpdateFunc: func(old, obj interface{}) {
+			sl.handle(ctx, out)(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if svc, ok := obj.(*corev1.Service); ok && svc.Name == sl.name {
+				listener.Observe("ips", "k8s.service", nil)
+				sl.ips = notifyChanged(ctx, out, sl.ips, map[string]interface{}{})
+			}
+		},
+	})
+	informer.Run(ctx.Done())
+}
+
+func (sl *ServiceIPLister) handle(ctx context.Context, out chan []string) func(interface{}) {
+	return func(obj interface{}) {
+		if svc, ok := obj.(*corev1.Service); ok && svc.Name == sl.name {
+			listener.Observe("ips", "k8s.service", nil)
+			ips := map[string]interface{}{}
+			for _, ingress := range svc.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					ips[ingress.IP] = nil
+				}
+			}
+			for _, ip := range svc.Spec.ExternalIPs {
+				ips[ip] = nil
+			}
+			sl.ips = notifyChanged(ctx, out, sl.ips, ips)
+		}
+	}
+}
+
+// NodeIPLister watches the external IPs of the nodes running the ready pods matching a selector,
+// typically the pods of the ingress controller
+type NodeIPLister struct {
+	pods     informers.SharedInformerFactory
+	nodes    informers.SharedInformerFactory
+	selector labels.Selector
+	ips      []string
+	// synced is set once the pods and nodes caches are filled, nothing is posted before
+	synced bool
+	lock   sync.Mutex
+}
+
+// NewNodeIPLister instanciates a lister watching nodes running pods matching selector in namespace
+func NewNodeIPLister(c kubernetes.Interface, namespace, selector string) (*NodeIPLister, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeIPLister{
+		pods: informers.NewSharedInformerFactoryWithOptions(
+			c, 30*time.Second,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = s.String()
+			}),
+		),
+		nodes:    informers.NewSharedInformerFactory(c, 30*time.Second),
+		selector: s,
+	}, nil
+}
+
+// Listen implements the Listener interface and posts the node external IPs
+// once the pods and nodes are listed, then every time they change.
+// Each change of the pods or nodes is counted as a poll of the k8s.nodes source in metrics
+func (nl *NodeIPLister) Listen(ctx context.Context, out chan []string) {
+	pods := nl.pods.Core().V1().Pods()
+	nodes := nl.nodes.Core().V1().Nodes()
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) {
+			nl.notify(ctx, out, pods.Lister().List, nodes.Lister().Get)
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			nl.notify(ctx, out, pods.Lister().List, nodes.Lister().Get)
+		},
+		DeleteFunc: func(interface{}) {
+			nl.notify(ctx, out, pods.Lister().List, nodes.Lister().Get)
+		},
+	}
+	pods.Informer().AddEventHandler(handler)
+	nodes.Informer().AddEventHandler(handler)
+	nl.pods.Start(ctx.Done())
+	nl.nodes.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), pods.Informer().HasSynced, nodes.Informer().HasSynced) {
+		return
+	}
+	nl.lock.Lock()
+	nl.synced = true
+	nl.lock.Unlock()
+	nl.notify(ctx, out, pods.Lister().List, nodes.Lister().Get)
+	<-ctx.Done()
+}
+
+func (nl *NodeIPLister) notify(ctx context.Context, out chan []string, listPods func(labels.Selector) ([]*corev1.Pod, error), getNode func(string) (*corev1.Node, error)) {
+	nl.lock.Lock()
+	defer nl.lock.Unlock()
+	if !nl.synced {
+		return
+	}
+	pods, err := listPods(nl.selector)
+	if listener.Observe("ips", "k8s.nodes", err) != nil {
+		return
+	}
+	ips := map[string]interface{}{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || !podReady(pod) {
+			continue
+		}
+		node, err := getNode(pod.Spec.NodeName)
+		if err != nil {
+			continue
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeExternalIP {
+				ips[address.Address] = nil
+			}
+		}
+	}
+	nl.ips = notifyChanged(ctx, out, nl.ips, ips)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// notifyChanged posts the sorted list of ips to out when it differs from old.
+// An empty list is only posted to withdraw previously posted IPs, it returns the last list posted
+func notifyChanged(ctx context.Context, out chan []string, old []string, ips map[string]interface{}) []string {
+	if len(ips) == 0 && len(old) == 0 {
+		return old
+	}
+	l := []string{}
+	for ip := range ips {
+		l = append(l, ip)
+	}
+	sort.Strings(l)
+	if reflect.DeepEqual(l, old) {
+		return old
+	}
+	if !listener.Send(ctx, out, l) {
+		return old
+	}
+	return l
+}
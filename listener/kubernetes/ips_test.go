@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tjamet/mohotani/metrics"
+)
+
+func receive(t *testing.T, out chan []string) []string {
+	select {
+	case ips := <-out:
+		return ips
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout reading the output channel")
+		return nil
+	}
+}
+
+func assertNothingReceived(t *testing.T, out chan []string) {
+	select {
+	case ips := <-out:
+		t.Errorf("Unexpected ips %s received", ips)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// expectPolls asserts the polls of the IPs of source are counted in metrics
+func expectPolls(t *testing.T, source string) {
+	text, err := metrics.Text()
+	assert.NoError(t, err)
+	assert.Contains(t, text, `mohotani_polls_total{listener="ips",source="`+source+`"}`)
+}
+
+func TestServiceIPLister(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "traefik", Namespace: "ingress"},
+		Spec: corev1.ServiceSpec{
+			Type:        corev1.ServiceTypeLoadBalancer,
+			ExternalIPs: []string{"203.0.113.2"},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.1"}, {Hostname: "lb.example.com"}},
+			},
+		},
+	}
+	other := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ingress"},
+		Spec:       corev1.ServiceSpec{ExternalIPs: []string{"198.51.100.1"}},
+	}
+	c := fake.NewSimpleClientset(svc, other)
+	out := make(chan []string)
+	go NewServiceIPLister(c, "ingress", "traefik").Listen(context.Background(), out)
+
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, receive(t, out))
+	expectPolls(t, "k8s.service")
+
+	svc.Spec.ExternalIPs = nil
+	_, err := c.CoreV1().Services("ingress").Update(svc)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1"}, receive(t, out))
+
+	svc.Labels = map[string]string{"updated": "true"}
+	_, err = c.CoreV1().Services("ingress").Update(svc)
+	assert.NoError(t, err)
+	assertNothingReceived(t, out)
+
+	err = c.CoreV1().Services("ingress").Delete("other", nil)
+	assert.NoError(t, err)
+	assertNothingReceived(t, out)
+	err = c.CoreV1().Services("ingress").Delete("traefik", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, receive(t, out))
+}
+
+func testPod(name, node string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ingress", Labels: map[string]string{"app": "traefik"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func testNode(name, ip string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+				{Type: corev1.NodeExternalIP, Address: ip},
+			},
+		},
+	}
+}
+
+func TestNodeIPLister(t *testing.T) {
+	c := fake.NewSimpleClientset(
+		testNode("node-1", "203.0.113.1"),
+		testNode("node-2", "203.0.113.2"),
+		testNode("node-3", "203.0.113.3"),
+		testPod("traefik-1", "node-1", corev1.ConditionTrue),
+		testPod("traefik-2", "node-2", corev1.ConditionFalse),
+	)
+	_, err := NewNodeIPLister(c, "ingress", "app in (")
+	assert.Error(t, err)
+
+	l, err := NewNodeIPLister(c, "ingress", "app=traefik")
+	assert.NoError(t, err)
+	out := make(chan []string)
+	go l.Listen(context.Background(), out)
+
+	assert.Equal(t, []string{"203.0.113.1"}, receive(t, out))
+	expectPolls(t, "k8s.nodes")
+
+	_, err = c.CoreV1().Pods("ingress").Update(testPod("traefik-2", "node-2", corev1.ConditionTrue))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, receive(t, out))
+
+	_, err = c.CoreV1().Nodes().Update(testNode("node-2", "203.0.113.22"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.22"}, receive(t, out))
+
+	unrelated := testPod("other", "node-3", corev1.ConditionTrue)
+	unrelated.Labels = map[string]string{"app": "other"}
+	_, err = c.CoreV1().Pods("ingress").Create(unrelated)
+	assert.NoError(t, err)
+	assertNothingReceived(t, out)
+
+	err = c.CoreV1().Pods("ingress").Delete("traefik-1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.22"}, receive(t, out))
+
+	err = c.CoreV1().Pods("ingress").Delete("traefik-2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, receive(t, out))
+}
@@ -1,22 +1,46 @@
 package listener
 
 import (
+	"context"
 	"reflect"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/tjamet/mohotani/logger"
+	"github.com/tjamet/mohotani/metrics"
+)
+
+var (
+	pollsTotal      = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_polls_total", Help: "The number of polls, by listener and resolution method"}, []string{"listener", "source"})
+	pollErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mohotani_poll_errors_total", Help: "The number of failed polls, by listener and resolution method"}, []string{"listener", "source"})
 )
 
+func init() {
+	metrics.Registry.MustRegister(pollsTotal, pollErrorsTotal)
+}
+
+// Observe counts a poll of the named listener and source in metrics, failed when err is not nil, and returns err.
+// Listeners notified of changes count each evaluation of their list as a poll
+func Observe(name, source string, err error) error {
+	pollsTotal.WithLabelValues(name, source).Inc()
+	if err != nil {
+		pollErrorsTotal.WithLabelValues(name, source).Inc()
+	}
+	return err
+}
+
 // Listener defines methods an object must implement to be used as a listener
 type Listener interface {
 	// Listen defines the method a Listener should implement to notify addition or removal
 	// in the list of elements
 	// Implementation should always post the whole new list of elements
-	Listen(chan []string)
+	// and return once ctx is done
+	Listen(ctx context.Context, out chan []string)
 }
 
 // Poll defines the interface a function should implement to be a poller
-type Poll func() ([]string, error)
+type Poll func(context.Context) ([]string, error)
 
 // PollListener a poller context
 type PollListener struct {
@@ -26,25 +50,100 @@ type PollListener struct {
 	Logger logger.Logger
 	// Poll is the function called to get the new state
 	Poll Poll
+	// Timeout is the maximum duration of a single poll, no timeout is applied when zero
+	Timeout time.Duration
+	// StablePolls is the number of consecutive polls a change must be observed in before being forwarded,
+	// changes are forwarded at the first poll when lower than 2
+	StablePolls int
+	// StableFor is the minimum duration a change must be observed for before being forwarded
+	StableFor time.Duration
+	// Name is the name of the listener in metrics, such as ips or domains
+	Name string
+	// Source is the name of the resolution method in metrics, such as ipify or docker
+	Source string
 }
 
-// Listen implements the Listener interface and forwards all chandes to out
-func (p *PollListener) Listen(out chan []string) {
-	old, err := p.Poll()
-	if err != nil {
-		p.Logger.Printf("error: failed to resolve ip: %s", err.Error())
-	} else {
-		out <- old
+// stable returns whether a change observed in polls consecutive polls since the given time can be forwarded
+func (p *PollListener) stable(polls int, since time.Time) bool {
+	return polls >= p.StablePolls && time.Since(since) >= p.StableFor
+}
+
+// log returns Logger, with the name and source of the listener as fields when set
+func (p *PollListener) log() logger.Logger {
+	if p.Name == "" {
+		return p.Logger
 	}
-	for range p.Ticker {
-		i, err := p.Poll()
-		if err != nil {
-			p.Logger.Printf("error: failed to resolve ip: %s", err.Error())
+	return logger.With(p.Logger, logger.Listener(p.Name), logger.F("source", p.Source))
+}
+
+func (p *PollListener) poll(ctx context.Context) ([]string, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	return p.Poll(ctx)
+}
+
+// Listen implements the Listener interface and forwards all chandes to out, until ctx is done or Ticker is closed.
+// Once the first list was forwarded, changes are only forwarded when stable according to
+// StablePolls and StableFor. Changes that are replaced before are logged and dropped
+func (p *PollListener) Listen(ctx context.Context, out chan []string) {
+	var old, candidate []string
+	var polls int
+	var since time.Time
+	first, pending := true, false
+	log := p.log()
+	for {
+		i, err := p.poll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if Observe(p.Name, p.Source, err) != nil {
+			log.Error("failed to poll", logger.Err(err))
+		} else if !first && reflect.DeepEqual(i, old) {
+			if pending {
+				log.Warn("ignoring unstable change, back to the forwarded values", logger.F("values", candidate), logger.F("polls", polls), logger.F("forwarded", old))
+				pending = false
+			}
 		} else {
-			if !reflect.DeepEqual(i, old) {
-				out <- i
+			if !pending || !reflect.DeepEqual(i, candidate) {
+				if pending {
+					log.Warn("ignoring unstable change, replaced by newer values", logger.F("values", candidate), logger.F("polls", polls), logger.F("replacement", i))
+				}
+				candidate = i
+				pending = true
+				polls = 0
+				since = time.Now()
+			}
+			polls++
+			if first || p.stable(polls, since) {
+				if !Send(ctx, out, i) {
+					return
+				}
 				old = i
+				pending = false
+				first = false
+			}
+		}
+		select {
+		case _, ok := <-p.Ticker:
+			if !ok {
+				return
 			}
+		case <-ctx.Done():
+			return
 		}
 	}
 }
+
+// Send posts elements to out, giving up when ctx is done.
+// It returns whether elements were posted
+func Send(ctx context.Context, out chan []string, elements []string) bool {
+	select {
+	case out <- elements:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
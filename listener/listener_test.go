@@ -1,11 +1,15 @@
 package listener
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
 )
 
 type testPoller struct {
@@ -13,7 +17,7 @@ type testPoller struct {
 	err <-chan error
 }
 
-func (r *testPoller) Poll() ([]string, error) {
+func (r *testPoller) Poll(ctx context.Context) ([]string, error) {
 	return <-r.IPs, <-r.err
 }
 
@@ -40,11 +44,11 @@ func TestWatch(t *testing.T) {
 	}
 
 	listener := &PollListener{
-		Logger: l,
+		Logger: logger.FromPrintf(l),
 		Ticker: ticker,
 		Poll:   r.Poll,
 	}
-	go listener.Listen(out)
+	go listener.Listen(context.Background(), out)
 	pollIPs <- []string{}
 	pollErrs <- nil
 	<-out
@@ -103,7 +107,163 @@ func TestWatch(t *testing.T) {
 	case out := <-out:
 		t.Errorf("An ip value %s value was output with a resolver in error", out)
 	case m := <-l.messages:
-		assert.Equal(t, "error: failed to resolve ip: test eror", m)
+		assert.Equal(t, "error: failed to poll error=\"test eror\"", m)
 	case <-time.After(100 * time.Millisecond):
 	}
 }
+
+func TestWatchTimeoutAndCancel(t *testing.T) {
+	l := &testLogger{
+		make(chan string, 10),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := &PollListener{
+		Logger:  logger.FromPrintf(l),
+		Ticker:  make(chan time.Time),
+		Timeout: 10 * time.Millisecond,
+		Poll: func(ctx context.Context) ([]string, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		listener.Listen(ctx, make(chan []string))
+		close(done)
+	}()
+	select {
+	case m := <-l.messages:
+		assert.Equal(t, "error: failed to poll error=\"context deadline exceeded\"", m)
+	case <-time.After(3 * time.Second):
+		t.Error("Timeout waiting for the poll to time out")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("Listen did not return after its context was cancelled")
+	}
+}
+
+func TestWatchClosedTicker(t *testing.T) {
+	ticker := make(chan time.Time)
+	out := make(chan []string, 10)
+	listener := &PollListener{
+		Logger: logger.FromPrintf(&testLogger{make(chan string, 10)}),
+		Ticker: ticker,
+		Poll: func(ctx context.Context) ([]string, error) {
+			return []string{"value 1"}, nil
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		listener.Listen(context.Background(), out)
+		close(done)
+	}()
+	close(ticker)
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("Listen did not return after its ticker was closed")
+	}
+}
+
+func TestWatchStability(t *testing.T) {
+	l := &testLogger{
+		make(chan string, 10),
+	}
+	ticker := make(chan time.Time)
+	out := make(chan []string, 10)
+	pollIPs := make(chan []string, 10)
+	pollErrs := make(chan error, 10)
+	r := &testPoller{
+		IPs: pollIPs,
+		err: pollErrs,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := &PollListener{
+		Logger:      logger.FromPrintf(l),
+		Ticker:      ticker,
+		Poll:        r.Poll,
+		StablePolls: 3,
+	}
+	go listener.Listen(ctx, out)
+	poll := func(ips ...string) {
+		pollIPs <- ips
+		pollErrs <- nil
+		ticker <- time.Now()
+	}
+	expectOut := func(expected []string) {
+		select {
+		case out := <-out:
+			assert.Equal(t, expected, out)
+		case <-time.After(3 * time.Second):
+			t.Error("Timeout reading the output channel")
+		}
+	}
+	expectMessage := func(expected string) {
+		select {
+		case m := <-l.messages:
+			assert.Equal(t, expected, m)
+		case <-time.After(3 * time.Second):
+			t.Error("Timeout reading the logger")
+		}
+	}
+
+	// the first value is forwarded immediately
+	pollIPs <- []string{"value 1"}
+	pollErrs <- nil
+	expectOut([]string{"value 1"})
+
+	// a flip is dropped and logged
+	poll("value 2")
+	poll("value 2")
+	poll("value 1")
+	expectMessage(`warning: ignoring unstable change, back to the forwarded values values="value 2" polls=2 forwarded="value 1"`)
+
+	poll("value 2")
+	poll("value 3")
+	expectMessage(`warning: ignoring unstable change, replaced by newer values values="value 2" polls=1 replacement="value 3"`)
+
+	// a change observed in enough consecutive polls is forwarded
+	poll("value 3")
+	poll("value 3")
+	expectOut([]string{"value 3"})
+	poll("value 3")
+	assert.Equal(t, 0, len(out))
+	assert.Equal(t, 0, len(l.messages))
+}
+
+func TestWatchMetrics(t *testing.T) {
+	l := &testLogger{
+		make(chan string, 10),
+	}
+	ticker := make(chan time.Time)
+	out := make(chan []string, 10)
+	pollIPs := make(chan []string, 10)
+	pollErrs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := &PollListener{
+		Logger: logger.FromPrintf(l),
+		Ticker: ticker,
+		Poll:   (&testPoller{IPs: pollIPs, err: pollErrs}).Poll,
+		Name:   "test",
+		Source: "metrics",
+	}
+	// the counters outlive the test in the default registry, only their increments are checked
+	polls := testutil.ToFloat64(pollsTotal.WithLabelValues("test", "metrics"))
+	pollErrors := testutil.ToFloat64(pollErrorsTotal.WithLabelValues("test", "metrics"))
+	go listener.Listen(ctx, out)
+	pollIPs <- []string{"value 1"}
+	pollErrs <- nil
+	<-out
+	pollIPs <- nil
+	pollErrs <- fmt.Errorf("test error")
+	ticker <- time.Now()
+	<-l.messages
+	assert.Equal(t, polls+2, testutil.ToFloat64(pollsTotal.WithLabelValues("test", "metrics")))
+	assert.Equal(t, pollErrors+1, testutil.ToFloat64(pollErrorsTotal.WithLabelValues("test", "metrics")))
+}
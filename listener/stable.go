@@ -0,0 +1,74 @@
+package listener
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+// StableListener forwards the lists of elements of a Listener once they did not change for StableFor.
+// It damps the listeners notifying changes as they happen, which can not count polls.
+// The first list is forwarded immediately, changes that are replaced or reverted before are logged and dropped
+type StableListener struct {
+	// Listener is the listener whose elements are damped
+	Listener Listener
+	// Logger is the logger in which dropped changes will be printed
+	Logger logger.Logger
+	// StableFor is the minimum duration a change must last before being forwarded, changes are forwarded immediately when zero
+	StableFor time.Duration
+}
+
+// Listen implements the Listener interface and forwards the stable changes to out
+func (s *StableListener) Listen(ctx context.Context, out chan []string) {
+	in := make(chan []string)
+	go s.Listener.Listen(ctx, in)
+	var forwarded, candidate []string
+	first, pending := true, false
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	stop := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, timerC = nil, nil
+	}
+	defer stop()
+	for {
+		select {
+		case elements := <-in:
+			if first || s.StableFor <= 0 {
+				if !Send(ctx, out, elements) {
+					return
+				}
+				forwarded = elements
+				first = false
+				continue
+			}
+			stop()
+			if reflect.DeepEqual(elements, forwarded) {
+				if pending {
+					s.Logger.Warn("ignoring unstable change, back to the forwarded values", logger.F("values", candidate), logger.F("forwarded", forwarded))
+					pending = false
+				}
+				continue
+			}
+			if pending {
+				s.Logger.Warn("ignoring unstable change, replaced by newer values", logger.F("values", candidate), logger.F("replacement", elements))
+			}
+			candidate, pending = elements, true
+			timer = time.NewTimer(s.StableFor)
+			timerC = timer.C
+		case <-timerC:
+			stop()
+			pending = false
+			if !Send(ctx, out, candidate) {
+				return
+			}
+			forwarded = candidate
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+func TestStableListener(t *testing.T) {
+	l := &testLogger{make(chan string, 10)}
+	inner := &testListener{make(chan chan []string)}
+	out := make(chan []string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := &StableListener{
+		Listener:  inner,
+		Logger:    logger.FromPrintf(l),
+		StableFor: 50 * time.Millisecond,
+	}
+	go listener.Listen(ctx, out)
+	in := <-inner.c
+	expectMessage := func(expected string) {
+		select {
+		case m := <-l.messages:
+			assert.Equal(t, expected, m)
+		case <-time.After(3 * time.Second):
+			t.Error("Timeout reading the logger")
+		}
+	}
+
+	// the first list is forwarded immediately
+	in <- []string{"value 1"}
+	expectList(t, out, []string{"value 1"})
+
+	// a flip is dropped and logged
+	in <- []string{"value 2"}
+	in <- []string{"value 1"}
+	expectMessage(`warning: ignoring unstable change, back to the forwarded values values="value 2" forwarded="value 1"`)
+
+	in <- []string{"value 2"}
+	in <- []string{"value 3"}
+	expectMessage(`warning: ignoring unstable change, replaced by newer values values="value 2" replacement="value 3"`)
+
+	// a change lasting long enough is forwarded
+	start := time.Now()
+	expectList(t, out, []string{"value 3"})
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "the change was forwarded before being stable")
+	select {
+	case out := <-out:
+		t.Errorf("An unstable list %s was forwarded", out)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, 0, len(l.messages))
+}
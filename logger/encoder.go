@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encoder defines methods an object must implement to format log entries
+type Encoder interface {
+	// Encode returns the entry as a single line, without the trailing new line
+	Encode(entry Entry) []byte
+}
+
+// NewEncoder returns the encoder of a format, one of text or json
+func NewEncoder(format string) (Encoder, error) {
+	switch format {
+	case "text":
+		return Text{}, nil
+	case "json":
+		return JSON{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %s, expecting one of text, json", format)
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Text encodes entries as logfmt key=value pairs, e.g.
+//
+//	time=2019-07-04T10:00:00.000Z level=info msg="updated domain" domain=www.example.com ips=203.0.113.1
+//
+// Lists are written as coma separated values
+type Text struct{}
+
+// Encode implements the Encoder interface
+func (Text) Encode(entry Entry) []byte {
+	return []byte(fmt.Sprintf("time=%s level=%s msg=%s%s", entry.Time.Format(timeFormat), entry.Level, quote(entry.Message), textFields(entry.Fields)))
+}
+
+func textFields(fields []Field) string {
+	b := strings.Builder{}
+	for _, field := range fields {
+		fmt.Fprintf(&b, " %s=%s", field.Key, quote(textValue(field.Value)))
+	}
+	return b.String()
+}
+
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// quote quotes values that would not be parsed back as a single value
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\n\t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// JSON encodes entries as JSON objects, with the fields as additional keys, e.g.
+//
+//	{"time":"2019-07-04T10:00:00.000Z","level":"info","msg":"updated domain","domain":"www.example.com","ips":["203.0.113.1"]}
+type JSON struct{}
+
+// Encode implements the Encoder interface
+func (JSON) Encode(entry Entry) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(`{"time":`)
+	writeJSON(b, entry.Time.Format(timeFormat))
+	b.WriteString(`,"level":`)
+	writeJSON(b, entry.Level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(b, entry.Message)
+	for _, field := range entry.Fields {
+		b.WriteString(",")
+		writeJSON(b, field.Key)
+		b.WriteString(":")
+		writeJSON(b, jsonValue(field.Value))
+	}
+	b.WriteString("}")
+	return b.Bytes()
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func writeJSON(b *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(encoded)
+}
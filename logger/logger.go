@@ -1,12 +1,163 @@
 package logger
 
-// Logger is the interface that WatchListener loggers must implement.
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger is the interface that loggers must implement, with a method per level.
+// Messages should be constant, the values they relate to are given as fields.
 // Typically, it can be instanciated as:
-// import (
-//		"log"
-//		"os"
-//	)
-// log.New(os.Stdout, "IP Watcher:", log.LstdFlags)
+//
+//	logger.New(os.Stdout, logger.Text{}, logger.InfoLevel)
+//
+// or adapt a Printf-style logger:
+//
+//	logger.FromPrintf(log.New(os.Stdout, "IP Watcher:", log.LstdFlags))
 type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// DebugLevel entries detail the normal operation
+	DebugLevel Level = iota
+	// InfoLevel entries report changes, such as updated records
+	InfoLevel
+	// WarnLevel entries report unexpected situations mohotani works around
+	WarnLevel
+	// ErrorLevel entries report failures
+	ErrorLevel
+)
+
+var levels = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levels[l]
+}
+
+// ParseLevel returns the level of a name, one of debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, level := range levels {
+		if strings.EqualFold(name, level) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %s, expecting one of %s", name, strings.Join(levels, ", "))
+}
+
+// Field is a key-value pair detailing a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Domain returns the field of a domain name
+func Domain(domain string) Field {
+	return F("domain", domain)
+}
+
+// IPs returns the field of a list of IPs
+func IPs(IPs []string) Field {
+	return F("ips", IPs)
+}
+
+// Provider returns the field of a DNS provider name
+func Provider(provider string) Field {
+	return F("provider", provider)
+}
+
+// Listener returns the field of a listener name
+func Listener(listener string) Field {
+	return F("listener", listener)
+}
+
+// Err returns the field of an error
+func Err(err error) Field {
+	return F("error", err)
+}
+
+// Log logs an entry at level with l
+func Log(l Logger, level Level, msg string, fields ...Field) {
+	switch level {
+	case DebugLevel:
+		l.Debug(msg, fields...)
+	case InfoLevel:
+		l.Info(msg, fields...)
+	case WarnLevel:
+		l.Warn(msg, fields...)
+	default:
+		l.Error(msg, fields...)
+	}
+}
+
+// logFunc implements the Logger interface with a single function
+type logFunc func(level Level, msg string, fields []Field)
+
+func (f logFunc) Debug(msg string, fields ...Field) { f(DebugLevel, msg, fields) }
+func (f logFunc) Info(msg string, fields ...Field)  { f(InfoLevel, msg, fields) }
+func (f logFunc) Warn(msg string, fields ...Field)  { f(WarnLevel, msg, fields) }
+func (f logFunc) Error(msg string, fields ...Field) { f(ErrorLevel, msg, fields) }
+
+// With returns a logger adding fields to all the entries logged with l
+func With(l Logger, fields ...Field) Logger {
+	return logFunc(func(level Level, msg string, extra []Field) {
+		Log(l, level, msg, append(append([]Field{}, fields...), extra...)...)
+	})
+}
+
+// Entry is a log entry
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []Field
+}
+
+// New returns a logger writing the entries of at least level to w, one per line, encoded by encoder
+func New(w io.Writer, encoder Encoder, level Level) Logger {
+	lock := sync.Mutex{}
+	return logFunc(func(l Level, msg string, fields []Field) {
+		if l < level {
+			return
+		}
+		line := encoder.Encode(Entry{Time: time.Now(), Level: l, Message: msg, Fields: fields})
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write(append(line, '\n'))
+	})
+}
+
+// Printfer is the interface of Printf-style loggers, such as *log.Logger
+type Printfer interface {
 	Printf(format string, v ...interface{})
 }
+
+var prefixes = []string{"debug: ", "", "warning: ", "error: "}
+
+// FromPrintf adapts a Printf-style logger, entries are printed as text prefixed by their level, except for info entries
+func FromPrintf(p Printfer) Logger {
+	return logFunc(func(level Level, msg string, fields []Field) {
+		prefix := ""
+		if level >= DebugLevel && level <= ErrorLevel {
+			prefix = prefixes[level]
+		}
+		p.Printf("%s%s%s", prefix, msg, textFields(fields))
+	})
+}
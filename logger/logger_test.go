@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPrinter struct {
+	messages []string
+}
+
+func (p *testPrinter) Printf(format string, v ...interface{}) {
+	p.messages = append(p.messages, fmt.Sprintf(format, v...))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, WarnLevel, level)
+	_, err = ParseLevel("verbose")
+	assert.EqualError(t, err, "unknown log level verbose, expecting one of debug, info, warn, error")
+}
+
+func TestEncoders(t *testing.T) {
+	entry := Entry{
+		Time:    time.Date(2019, 7, 4, 10, 0, 0, 0, time.UTC),
+		Level:   ErrorLevel,
+		Message: "failed to update domain",
+		Fields:  []Field{Domain("www.example.com"), IPs([]string{"203.0.113.1", "2001:db8::1"}), Err(fmt.Errorf(`status "503"`)), F("delay", time.Second), F("attempt", 2)},
+	}
+	assert.Equal(t,
+		`time=2019-07-04T10:00:00.000Z level=error msg="failed to update domain" domain=www.example.com ips=203.0.113.1,2001:db8::1 error="status \"503\"" delay=1s attempt=2`,
+		string(Text{}.Encode(entry)),
+	)
+	assert.Equal(t,
+		`{"time":"2019-07-04T10:00:00.000Z","level":"error","msg":"failed to update domain","domain":"www.example.com","ips":["203.0.113.1","2001:db8::1"],"error":"status \"503\"","delay":"1s","attempt":2}`,
+		string(JSON{}.Encode(entry)),
+	)
+
+	_, err := NewEncoder("xml")
+	assert.EqualError(t, err, "unknown log format xml, expecting one of text, json")
+}
+
+func TestNew(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := With(New(b, Text{}, InfoLevel), Listener("ips"))
+	l.Debug("polled")
+	l.Info("published", IPs([]string{"203.0.113.1"}))
+	l.Warn("unstable")
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `level=info msg=published listener=ips ips=203.0.113.1`)
+	assert.Contains(t, lines[1], `level=warn msg=unstable listener=ips`)
+}
+
+func TestFromPrintf(t *testing.T) {
+	p := &testPrinter{}
+	l := FromPrintf(p)
+	l.Debug("polled", Listener("ips"))
+	l.Info("updated domain", Domain("www.example.com"))
+	l.Warn("target is unhealthy", F("target", "203.0.113.1"))
+	l.Error("failed to serve http", Err(fmt.Errorf("address already in use")))
+	assert.Equal(t, []string{
+		"debug: polled listener=ips",
+		"updated domain domain=www.example.com",
+		"warning: target is unhealthy target=203.0.113.1",
+		`error: failed to serve http error="address already in use"`,
+	}, p.messages)
+}
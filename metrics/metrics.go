@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Registry holds the metrics of mohotani, along with the metrics of the Go runtime and of the process
+var Registry = prometheus.NewRegistry()
+
+// DefaultBuckets are the upper bounds of the histogram buckets of durations, in seconds
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+func init() {
+	Registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+// Handler returns the handler serving the metrics of Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Text returns the metrics of Registry in the Prometheus text format
+func Text() (string, error) {
+	families, err := Registry.Gather()
+	if err != nil {
+		return "", err
+	}
+	b := &bytes.Buffer{}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(b, family); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
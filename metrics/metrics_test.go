@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	polls := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_polls_total", Help: "The number of polls"}, []string{"listener"})
+	Registry.MustRegister(polls)
+	defer Registry.Unregister(polls)
+	polls.WithLabelValues("ips").Inc()
+	polls.WithLabelValues("ips").Inc()
+	polls.WithLabelValues(`dom"ains`).Inc()
+
+	expected := `# HELP test_polls_total The number of polls
+# TYPE test_polls_total counter
+test_polls_total{listener="dom\"ains"} 1
+test_polls_total{listener="ips"} 2
+`
+	text, err := Text()
+	assert.NoError(t, err)
+	assert.Contains(t, text, expected)
+	assert.Contains(t, text, "# TYPE go_goroutines gauge\n")
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), expected)
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Kind is the kind of an event
+type Kind string
+
+const (
+	// IPChanged is notified when the IPs of the records change
+	IPChanged Kind = "ip-changed"
+	// DomainAdded is notified when a domain is added to the list of domains
+	DomainAdded Kind = "domain-added"
+	// DomainRemoved is notified when a domain is removed from the list of domains
+	DomainRemoved Kind = "domain-removed"
+	// UpdateFailed is notified when the records of a domain fail to be updated, further failures are not notified until it recovers
+	UpdateFailed Kind = "update-failed"
+	// Recovered is notified when the records of a domain are updated after a failure
+	Recovered Kind = "recovered"
+)
+
+// Kinds are all the kinds of events
+var Kinds = []Kind{IPChanged, DomainAdded, DomainRemoved, UpdateFailed, Recovered}
+
+// Event is a change notified to users
+type Event struct {
+	Kind Kind      `json:"kind"`
+	Time time.Time `json:"time"`
+	// Owner is the name of the updater
+	Owner    string `json:"owner,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	// IPs are the IPs the records are updated with
+	IPs []string `json:"ips,omitempty"`
+	// PreviousIPs are the IPs before an IPChanged event
+	PreviousIPs []string `json:"previousIPs,omitempty"`
+	// Error is the error of an UpdateFailed event
+	Error string `json:"error,omitempty"`
+	// Attempt is the number of retries of a failed update
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Notifier defines methods an object must implement to notify events
+type Notifier interface {
+	// Notify sends the event, implementations should give up when ctx is done
+	Notify(ctx context.Context, event Event) error
+}
+
+// All notifies events to all notifiers
+type All []Notifier
+
+// Notify implements the Notifier interface, it returns the errors of all the notifiers that failed
+func (a All) Notify(ctx context.Context, event Event) error {
+	messages := []string{}
+	for _, n := range a {
+		if err := n.Notify(ctx, event); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(messages, ", "))
+}
+
+// Filter only notifies the events of the given kinds
+type Filter struct {
+	Notifier Notifier
+	Kinds    []Kind
+}
+
+// Notify implements the Notifier interface
+func (f *Filter) Notify(ctx context.Context, event Event) error {
+	for _, kind := range f.Kinds {
+		if kind == event.Kind {
+			return f.Notifier.Notify(ctx, event)
+		}
+	}
+	return nil
+}
+
+// ParseKinds parses coma separated kinds of events
+func ParseKinds(kinds string) ([]Kind, error) {
+	parsed := []Kind{}
+	for _, name := range strings.Split(kinds, ",") {
+		kind := Kind(strings.TrimSpace(name))
+		known := false
+		for _, k := range Kinds {
+			known = known || k == kind
+		}
+		if !known {
+			names := []string{}
+			for _, k := range Kinds {
+				names = append(names, string(k))
+			}
+			return nil, fmt.Errorf("unknown event %s, expecting one of %s", kind, strings.Join(names, ", "))
+		}
+		parsed = append(parsed, kind)
+	}
+	return parsed, nil
+}
+
+// DefaultTemplate is the text of the messages when no template is given
+const DefaultTemplate = `{{if eq .Kind "ip-changed"}}IPs changed from [{{join .PreviousIPs ", "}}] to [{{join .IPs ", "}}]
+{{- else if eq .Kind "domain-added"}}Domain {{.Domain}} was added
+{{- else if eq .Kind "domain-removed"}}Domain {{.Domain}} was removed
+{{- else if eq .Kind "update-failed"}}Failed to update the records of {{.Domain}} with [{{join .IPs ", "}}]: {{.Error}}
+{{- else if eq .Kind "recovered"}}Recovered, updated the records of {{.Domain}} with [{{join .IPs ", "}}]{{if .Attempt}} after {{.Attempt}} retries{{end}}
+{{- end}}`
+
+// Funcs are the functions available in templates, in addition to the text/template ones:
+// join joins a list of strings with a separator, json encodes a value as JSON,
+// and escapeJSON escapes the text of a value to be embedded in a JSON string
+var Funcs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"escapeJSON": func(v interface{}) (string, error) {
+		b, err := json.Marshal(fmt.Sprint(v))
+		if err != nil {
+			return "", err
+		}
+		return string(b[1 : len(b)-1]), nil
+	},
+}
+
+// Parse parses a template rendered with events
+func Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(Funcs).Parse(text)
+}
+
+// ParseFile parses the template in a file
+func ParseFile(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to read template %s", path))
+	}
+	return Parse(path, string(text))
+}
+
+var defaultTemplate = template.Must(Parse("default", DefaultTemplate))
+
+// render renders the event with t, or with DefaultTemplate when t is nil
+func render(t *template.Template, event Event) (string, error) {
+	if t == nil {
+		t = defaultTemplate
+	}
+	b := &bytes.Buffer{}
+	if err := t.Execute(b, event); err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("unable to render template %s", t.Name()))
+	}
+	return b.String(), nil
+}
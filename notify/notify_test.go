@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNotifier struct {
+	events []Event
+	err    error
+}
+
+func (n *testNotifier) Notify(ctx context.Context, event Event) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	for _, test := range []struct {
+		event    Event
+		expected string
+	}{
+		{Event{Kind: IPChanged, IPs: []string{"203.0.113.2"}, PreviousIPs: []string{"203.0.113.1"}}, "IPs changed from [203.0.113.1] to [203.0.113.2]"},
+		{Event{Kind: DomainAdded, Domain: "www.example.com"}, "Domain www.example.com was added"},
+		{Event{Kind: DomainRemoved, Domain: "www.example.com"}, "Domain www.example.com was removed"},
+		{Event{Kind: UpdateFailed, Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Error: "test error"}, "Failed to update the records of www.example.com with [203.0.113.1]: test error"},
+		{Event{Kind: Recovered, Domain: "www.example.com", IPs: []string{"203.0.113.1"}, Attempt: 2}, "Recovered, updated the records of www.example.com with [203.0.113.1] after 2 retries"},
+		{Event{Kind: Recovered, Domain: "www.example.com", IPs: []string{"203.0.113.1"}}, "Recovered, updated the records of www.example.com with [203.0.113.1]"},
+	} {
+		text, err := render(nil, test.event)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, text)
+	}
+
+	tmpl, err := Parse("test", `{"ips":{{json .IPs}},"at":"{{.Time.Format "2006-01-02"}}"}`)
+	assert.NoError(t, err)
+	text, err := render(tmpl, Event{Kind: IPChanged, IPs: []string{"203.0.113.1"}, Time: time.Date(2019, 7, 4, 10, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ips":["203.0.113.1"],"at":"2019-07-04"}`, text)
+
+	tmpl, err = Parse("test", `{{.Missing}}`)
+	assert.NoError(t, err)
+	_, err = render(tmpl, Event{})
+	assert.Error(t, err)
+}
+
+func TestAllAndFilter(t *testing.T) {
+	first := &testNotifier{err: fmt.Errorf("first error")}
+	second := &testNotifier{}
+	third := &testNotifier{err: fmt.Errorf("third error")}
+	n := All{first, &Filter{Notifier: second, Kinds: []Kind{UpdateFailed, Recovered}}, third}
+
+	err := n.Notify(context.Background(), Event{Kind: IPChanged})
+	assert.EqualError(t, err, "first error, third error")
+	err = n.Notify(context.Background(), Event{Kind: Recovered})
+	assert.EqualError(t, err, "first error, third error")
+	assert.Equal(t, []Event{{Kind: IPChanged}, {Kind: Recovered}}, first.events)
+	assert.Equal(t, []Event{{Kind: Recovered}}, second.events)
+
+	second.err = nil
+	assert.NoError(t, All{second}.Notify(context.Background(), Event{Kind: IPChanged}))
+}
+
+func TestParseKinds(t *testing.T) {
+	kinds, err := ParseKinds("ip-changed, update-failed,recovered")
+	assert.NoError(t, err)
+	assert.Equal(t, []Kind{IPChanged, UpdateFailed, Recovered}, kinds)
+	_, err = ParseKinds("ip-changed,rebooted")
+	assert.EqualError(t, err, "unknown event rebooted, expecting one of ip-changed, domain-added, domain-removed, update-failed, recovered")
+}
@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSubject is the subject of the mails when no subject template is given
+const DefaultSubject = `[mohotani] {{.Kind}}{{if .Domain}} {{.Domain}}{{end}}`
+
+var defaultSubject = template.Must(Parse("subject", DefaultSubject))
+
+// SMTP sends events by mail.
+// The connection is upgraded with STARTTLS when the server supports it, unless it uses implicit TLS
+type SMTP struct {
+	// Addr is the address of the server, with format <host>:<port>
+	Addr string
+	// TLS connects to the server with TLS from the start instead of upgrading the connection with STARTTLS,
+	// it is always set on the submission port 465
+	TLS  bool
+	From string
+	To   []string
+	// Username and Password authenticate to the server with PLAIN authentication when set,
+	// which requires STARTTLS unless the server is local
+	Username string
+	Password string
+	// Subject renders the subject of the mails, defaults to DefaultSubject
+	Subject *template.Template
+	// Template renders the body of the mails, defaults to DefaultTemplate
+	Template *template.Template
+
+	// roots are the certificate authorities trusted instead of the system ones
+	roots *x509.CertPool
+}
+
+// Notify implements the Notifier interface
+func (s *SMTP) Notify(ctx context.Context, event Event) error {
+	subject := s.Subject
+	if subject == nil {
+		subject = defaultSubject
+	}
+	title, err := render(subject, event)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", s.Addr))
+	}
+	body, err := render(s.Template, event)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", s.Addr))
+	}
+	err = s.send(ctx, s.message(event.Time, title, body))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", s.Addr))
+	}
+	return nil
+}
+
+// message formats a plain text mail
+func (s *SMTP) message(date time.Time, subject, body string) []byte {
+	headers := []string{
+		"From: " + s.From,
+		"To: " + strings.Join(s.To, ", "),
+		"Subject: " + strings.Replace(strings.Replace(subject, "\r", "", -1), "\n", " ", -1),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body = strings.Replace(strings.Replace(body, "\r\n", "\n", -1), "\n", "\r\n", -1)
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
+
+func (s *SMTP) send(ctx context.Context, message []byte) error {
+	host, port, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	config := &tls.Config{ServerName: host, RootCAs: s.roots}
+	implicit := s.TLS || port == "465"
+	if implicit {
+		secure := tls.Client(conn, config)
+		if err := secure.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = secure
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && !implicit {
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
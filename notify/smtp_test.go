@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mail is a message received by the SMTP stand-in
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP runs a minimal SMTP server accepting all mails, until l is closed
+func serveSMTP(l net.Listener, mails chan<- mail) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			c := textproto.NewConn(conn)
+			c.PrintfLine("220 localhost test SMTP server")
+			m := mail{}
+			for {
+				line, err := c.ReadLine()
+				if err != nil {
+					return
+				}
+				command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+				switch command {
+				case "EHLO", "HELO":
+					c.PrintfLine("250 localhost")
+				case "MAIL":
+					m.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+					c.PrintfLine("250 OK")
+				case "RCPT":
+					m.to = append(m.to, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+					c.PrintfLine("250 OK")
+				case "DATA":
+					c.PrintfLine("354 send the data")
+					data, err := c.ReadDotBytes()
+					if err != nil {
+						return
+					}
+					m.data = string(data)
+					mails <- m
+					c.PrintfLine("250 OK")
+				case "QUIT":
+					c.PrintfLine("221 bye")
+					return
+				default:
+					c.PrintfLine("502 not implemented")
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	mails := make(chan mail, 10)
+	go serveSMTP(l, mails)
+
+	s := &SMTP{
+		Addr: l.Addr().String(),
+		From: "mohotani@example.com",
+		To:   []string{"admin@example.com", "ops@example.com"},
+	}
+	event := Event{
+		Kind:   UpdateFailed,
+		Time:   time.Date(2019, 7, 4, 10, 0, 0, 0, time.UTC),
+		Domain: "www.example.com",
+		IPs:    []string{"203.0.113.1"},
+		Error:  "test error",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Notify(ctx, event))
+	m := <-mails
+	assert.Equal(t, "mohotani@example.com", m.from)
+	assert.Equal(t, []string{"admin@example.com", "ops@example.com"}, m.to)
+	assert.Equal(t, strings.Join([]string{
+		"From: mohotani@example.com",
+		"To: admin@example.com, ops@example.com",
+		"Subject: [mohotani] update-failed www.example.com",
+		"Date: Thu, 04 Jul 2019 10:00:00 +0000",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		"Failed to update the records of www.example.com with [203.0.113.1]: test error",
+		"",
+	}, "\n"), m.data)
+
+	s.Subject, _ = Parse("subject", "DNS {{.Kind}}\nfor {{.Domain}}")
+	s.Template, _ = Parse("body", "{{.Domain}}\n{{.Error}}")
+	assert.NoError(t, s.Notify(ctx, event))
+	m = <-mails
+	assert.Contains(t, m.data, "Subject: DNS update-failed for www.example.com\n")
+	assert.True(t, strings.HasSuffix(m.data, "\n\nwww.example.com\ntest error\n"), m.data)
+
+	l.Close()
+	assert.Error(t, s.Notify(ctx, event))
+}
+
+func TestSMTPImplicitTLS(t *testing.T) {
+	// the test server only provides its certificate, valid for 127.0.0.1
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: server.TLS.Certificates})
+	assert.NoError(t, err)
+	defer l.Close()
+	mails := make(chan mail, 10)
+	go serveSMTP(l, mails)
+
+	s := &SMTP{
+		Addr:  l.Addr().String(),
+		TLS:   true,
+		From:  "mohotani@example.com",
+		To:    []string{"admin@example.com"},
+		roots: roots,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Notify(ctx, Event{Kind: DomainAdded, Domain: "www.example.com"}))
+	m := <-mails
+	assert.Equal(t, []string{"admin@example.com"}, m.to)
+	assert.True(t, strings.HasSuffix(m.data, "\n\nDomain www.example.com was added\n"), m.data)
+
+	s.roots = nil
+	assert.Error(t, s.Notify(ctx, Event{Kind: DomainAdded, Domain: "www.example.com"}))
+}
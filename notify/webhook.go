@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Webhook posts events to an http endpoint
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	// Template renders the body of the requests, the event is posted as a JSON object when nil.
+	// The rendered body must be valid JSON, values are embedded with the json and escapeJSON functions
+	Template *template.Template
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Notify implements the Notifier interface
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	var body []byte
+	var err error
+	if w.Template == nil {
+		body, err = json.Marshal(event)
+	} else {
+		var text string
+		text, err = render(w.Template, event)
+		body = []byte(text)
+		if err == nil && !json.Valid(body) {
+			err = fmt.Errorf("template %s did not render valid JSON, values should be embedded with the json and escapeJSON functions", w.Template.Name())
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", w.URL))
+	}
+	return post(ctx, w.Client, w.URL, w.Headers, body)
+}
+
+// Slack posts events to Slack or Mattermost compatible incoming webhooks
+type Slack struct {
+	URL string
+	// Template renders the text of the messages, defaults to DefaultTemplate
+	Template *template.Template
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Notify implements the Notifier interface
+func (s *Slack) Notify(ctx context.Context, event Event) error {
+	text, err := render(s.Template, event)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", s.URL))
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", s.URL))
+	}
+	return post(ctx, s.Client, s.URL, nil, body)
+}
+
+// post posts a JSON body to url and expects a 2xx status
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", url))
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to notify %s", url))
+	}
+	defer response.Body.Close()
+	ioutil.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unable to notify %s, unexpected http code %d", url, response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func newTestServer(status int) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+	return server, requests
+}
+
+func TestWebhook(t *testing.T) {
+	server, requests := newTestServer(http.StatusNoContent)
+	defer server.Close()
+	event := Event{
+		Kind:        IPChanged,
+		Time:        time.Date(2019, 7, 4, 10, 0, 0, 0, time.UTC),
+		Owner:       "mohotani",
+		IPs:         []string{"203.0.113.2"},
+		PreviousIPs: []string{"203.0.113.1"},
+	}
+
+	w := &Webhook{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	assert.NoError(t, w.Notify(context.Background(), event))
+	r := <-requests
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", r.header.Get("Authorization"))
+	assert.JSONEq(t, `{"kind":"ip-changed","time":"2019-07-04T10:00:00Z","owner":"mohotani","ips":["203.0.113.2"],"previousIPs":["203.0.113.1"]}`, r.body)
+
+	w.Template, _ = Parse("test", `{"summary":"{{.Kind}} to {{join .IPs ","}}"}`)
+	assert.NoError(t, w.Notify(context.Background(), event))
+	r = <-requests
+	assert.Equal(t, `{"summary":"ip-changed to 203.0.113.2"}`, r.body)
+
+	failed := Event{Kind: UpdateFailed, Domain: "www.example.com", Error: "unexpected \"status\"\nretrying"}
+	w.Template, _ = Parse("test", `{"summary":"{{.Domain}}: {{escapeJSON .Error}}","ips":{{json .IPs}}}`)
+	assert.NoError(t, w.Notify(context.Background(), failed))
+	r = <-requests
+	assert.JSONEq(t, `{"summary":"www.example.com: unexpected \"status\"\nretrying","ips":null}`, r.body)
+
+	w.Template, _ = Parse("test", `{"summary":"{{.Domain}}: {{.Error}}"}`)
+	err := w.Notify(context.Background(), failed)
+	assert.EqualError(t, err, "unable to notify "+server.URL+": template test did not render valid JSON, values should be embedded with the json and escapeJSON functions")
+	assert.Equal(t, 0, len(requests))
+}
+
+func TestSlack(t *testing.T) {
+	server, requests := newTestServer(http.StatusOK)
+	defer server.Close()
+	s := &Slack{URL: server.URL}
+	assert.NoError(t, s.Notify(context.Background(), Event{Kind: DomainAdded, Domain: "www.example.com"}))
+	r := <-requests
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+	assert.JSONEq(t, `{"text":"Domain www.example.com was added"}`, r.body)
+
+	s.Template, _ = Parse("test", `:warning: {{.Domain}} is "down"`)
+	assert.NoError(t, s.Notify(context.Background(), Event{Kind: UpdateFailed, Domain: "www.example.com"}))
+	r = <-requests
+	assert.JSONEq(t, `{"text":":warning: www.example.com is \"down\""}`, r.body)
+}
+
+func TestWebhookErrors(t *testing.T) {
+	server, requests := newTestServer(http.StatusInternalServerError)
+	defer server.Close()
+	err := (&Webhook{URL: server.URL}).Notify(context.Background(), Event{Kind: IPChanged})
+	assert.EqualError(t, err, "unable to notify "+server.URL+", unexpected http code 500")
+	<-requests
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, (&Slack{URL: server.URL}).Notify(ctx, Event{Kind: IPChanged}))
+}
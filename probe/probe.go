@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports the status of a component.
+// The details are included in the response, the component is failing when an error is returned.
+// The probe answers once all checks returned, ctx is done when the probe times out
+type Check func(ctx context.Context) (details interface{}, err error)
+
+// Status is the status of a component
+type Status struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Report is the response of a probe, it is ok when all its components are ok
+type Report struct {
+	Status     string            `json:"status"`
+	Components map[string]Status `json:"components"`
+}
+
+const (
+	// OK is the status of healthy components
+	OK = "ok"
+	// Failing is the status of unhealthy components
+	Failing = "failing"
+)
+
+// Handler is an http.Handler answering the status of components as JSON.
+// It answers 200 when all components are ok, 503 otherwise
+type Handler struct {
+	// Timeout is the maximum duration of each check, no timeout is applied when zero
+	Timeout time.Duration
+
+	lock   sync.Mutex
+	checks map[string]Check
+}
+
+// Set adds or replaces the check of a component
+func (h *Handler) Set(name string, check Check) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.checks == nil {
+		h.checks = map[string]Check{}
+	}
+	h.checks[name] = check
+}
+
+// Delete drops the check of a component
+func (h *Handler) Delete(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.checks, name)
+}
+
+// Report runs all checks concurrently
+func (h *Handler) Report(ctx context.Context) Report {
+	h.lock.Lock()
+	names := []string{}
+	checks := []Check{}
+	for name, check := range h.checks {
+		names = append(names, name)
+		checks = append(checks, check)
+	}
+	h.lock.Unlock()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	statuses := make([]Status, len(checks))
+	wg := sync.WaitGroup{}
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			details, err := check(ctx)
+			statuses[i] = Status{Status: OK, Details: details}
+			if err != nil {
+				statuses[i].Status = Failing
+				statuses[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+	report := Report{Status: OK, Components: map[string]Status{}}
+	for i, name := range names {
+		report.Components[name] = statuses[i]
+		if statuses[i].Status != OK {
+			report.Status = Failing
+		}
+	}
+	return report
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report := h.Report(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, h http.Handler) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	body := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{Timeout: 50 * time.Millisecond}
+	code, body := get(t, h)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "ok", "components": map[string]interface{}{}}, body)
+
+	h.Set("election", func(ctx context.Context) (interface{}, error) {
+		return map[string]bool{"leader": true}, nil
+	})
+	code, body = get(t, h)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{
+		"status": "ok",
+		"components": map[string]interface{}{
+			"election": map[string]interface{}{"status": "ok", "details": map[string]interface{}{"leader": true}},
+		},
+	}, body)
+
+	h.Set("failing", func(ctx context.Context) (interface{}, error) {
+		return nil, fmt.Errorf("test error")
+	})
+	h.Set("stuck", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	code, body = get(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]interface{}{
+		"status": "failing",
+		"components": map[string]interface{}{
+			"election": map[string]interface{}{"status": "ok", "details": map[string]interface{}{"leader": true}},
+			"failing":  map[string]interface{}{"status": "failing", "error": "test error"},
+			"stuck":    map[string]interface{}{"status": "failing", "error": "context deadline exceeded"},
+		},
+	}, body)
+
+	h.Delete("failing")
+	h.Delete("stuck")
+	code, _ = get(t, h)
+	assert.Equal(t, http.StatusOK, code)
+}
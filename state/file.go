@@ -0,0 +1,60 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// File persists the state as JSON in a local file
+type File struct {
+	// Path is the path of the file, created on the first save
+	Path string
+}
+
+// Load implements the Store interface
+func (f *File) Load(ctx context.Context) (State, error) {
+	s := State{}
+	content, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, errors.Wrap(err, fmt.Sprintf("unable to read the state from %s", f.Path))
+	}
+	err = json.Unmarshal(content, &s)
+	if err != nil {
+		return s, errors.Wrap(err, fmt.Sprintf("unable to parse the state from %s", f.Path))
+	}
+	return s, nil
+}
+
+// Save implements the Store interface.
+// The state is written to a temporary file, then renamed, so the file is never left partially written
+func (f *File) Save(ctx context.Context, s State) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize the state")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".")
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to write the state to %s", f.Path))
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to write the state to %s", f.Path))
+	}
+	return nil
+}
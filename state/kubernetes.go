@@ -0,0 +1,151 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Key is the key of the state in the data of config maps and secrets
+const Key = "state.json"
+
+// ConfigMap persists the state as JSON in a kubernetes config map, or a secret, created on the first save
+type ConfigMap struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+	// Secret stores the state in a secret rather than a config map
+	Secret bool
+}
+
+func (c *ConfigMap) kind() string {
+	if c.Secret {
+		return "secret"
+	}
+	return "config map"
+}
+
+// get returns the serialized state and whether the object holds one
+func (c *ConfigMap) get() ([]byte, bool, error) {
+	if c.Secret {
+		secret, err := c.Client.CoreV1().Secrets(c.Namespace).Get(c.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, false, err
+		}
+		content, ok := secret.Data[Key]
+		return content, ok, nil
+	}
+	configMap, err := c.Client.CoreV1().ConfigMaps(c.Namespace).Get(c.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	content, ok := configMap.Data[Key]
+	return []byte(content), ok, nil
+}
+
+// wait runs f, which calls the kubernetes API, until ctx is done.
+// This version of the kubernetes client takes no context, so f is left to complete in the background when ctx is done first
+func wait(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Load implements the Store interface
+func (c *ConfigMap) Load(ctx context.Context) (State, error) {
+	s := State{}
+	var content []byte
+	var ok bool
+	err := wait(ctx, func() error {
+		var err error
+		content, ok, err = c.get()
+		return err
+	})
+	if apierrors.IsNotFound(err) || (err == nil && !ok) {
+		return s, nil
+	}
+	if err != nil {
+		return s, errors.Wrap(err, fmt.Sprintf("unable to read the state from %s %s/%s", c.kind(), c.Namespace, c.Name))
+	}
+	err = json.Unmarshal(content, &s)
+	if err != nil {
+		return s, errors.Wrap(err, fmt.Sprintf("unable to parse the state from %s %s/%s", c.kind(), c.Namespace, c.Name))
+	}
+	return s, nil
+}
+
+// Save implements the Store interface
+func (c *ConfigMap) Save(ctx context.Context, s State) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize the state")
+	}
+	err = wait(ctx, func() error {
+		if c.Secret {
+			return c.saveSecret(content)
+		}
+		return c.saveConfigMap(content)
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to write the state to %s %s/%s", c.kind(), c.Namespace, c.Name))
+	}
+	return nil
+}
+
+func (c *ConfigMap) saveConfigMap(content []byte) error {
+	client := c.Client.CoreV1().ConfigMaps(c.Namespace)
+	configMap, err := client.Get(c.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.Name, Namespace: c.Namespace},
+			Data:       map[string]string{Key: string(content)},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[Key] = string(content)
+	_, err = client.Update(configMap)
+	return err
+}
+
+func (c *ConfigMap) saveSecret(content []byte) error {
+	client := c.Client.CoreV1().Secrets(c.Namespace)
+	secret, err := client.Get(c.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: c.Name, Namespace: c.Namespace},
+			Data:       map[string][]byte{Key: content},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[Key] = content
+	_, err = client.Update(secret)
+	return err
+}
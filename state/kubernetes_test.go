@@ -0,0 +1,48 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMap(t *testing.T) {
+	s := State{Providers: map[string]map[string]Record{
+		"gandi": {"www.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"}},
+	}}
+	for _, secret := range []bool{false, true} {
+		c := fake.NewSimpleClientset()
+		store := &ConfigMap{Client: c, Namespace: "dns", Name: "mohotani", Secret: secret}
+
+		loaded, err := store.Load(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, State{}, loaded)
+
+		assert.NoError(t, store.Save(context.Background(), s))
+		s.Providers["gandi"]["www2.example.com"] = Record{IPs: []string{"203.0.113.2"}, Owner: "mohotani"}
+		assert.NoError(t, store.Save(context.Background(), s))
+		loaded, err = store.Load(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, s, loaded)
+
+		if secret {
+			secret, err := c.CoreV1().Secrets("dns").Get("mohotani", metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Contains(t, string(secret.Data[Key]), "www2.example.com")
+		} else {
+			configMap, err := c.CoreV1().ConfigMaps("dns").Get("mohotani", metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Contains(t, configMap.Data[Key], "www2.example.com")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = store.Load(ctx)
+		assert.Error(t, err)
+		assert.Error(t, store.Save(ctx, s))
+		delete(s.Providers["gandi"], "www2.example.com")
+	}
+}
@@ -0,0 +1,196 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tjamet/mohotani/logger"
+)
+
+// Record is the state of the records of a domain
+type Record struct {
+	// IPs are the values of the records last applied
+	IPs []string `json:"ips,omitempty"`
+	// Owner identifies the updater managing the records of the domain
+	Owner string `json:"owner"`
+	// Updated is the time the records were last applied
+	Updated time.Time `json:"updated,omitempty"`
+	// Retry is the pending retry of a failed update of the records, if any
+	Retry *Retry `json:"retry,omitempty"`
+}
+
+// Retry is a pending retry of a failed update
+type Retry struct {
+	// IPs are the values the records failed to be updated with
+	IPs []string `json:"ips"`
+	// Attempt is the number of retries of the update already failed
+	Attempt int `json:"attempt"`
+	// Error is the message of the last failure
+	Error string `json:"error"`
+}
+
+// State is the state of the records of all domains, by provider
+type State struct {
+	Providers map[string]map[string]Record `json:"providers"`
+}
+
+// Store defines the interface a backend must implement to persist the state
+type Store interface {
+	// Load returns the persisted state, an empty state is returned when nothing was persisted yet
+	Load(ctx context.Context) (State, error)
+	// Save persists state, replacing the previous one
+	Save(ctx context.Context, state State) error
+}
+
+// Registry holds the state in memory and persists it in a Store in the background.
+// It can be shared by several updaters
+type Registry struct {
+	// Timeout is the maximum duration of a save, no timeout is applied when zero
+	Timeout time.Duration
+	// Logger is the logger in which failed saves will be printed, they are not printed when nil
+	Logger logger.Logger
+
+	store Store
+	lock  sync.Mutex
+	state State
+	// dirty is set when the state changed since it was last persisted
+	dirty bool
+	// idle is closed once the running writer stops, it is nil when no writer is running
+	idle chan struct{}
+	// err is the error of the last save
+	err error
+}
+
+// Open loads the state persisted in store
+func Open(ctx context.Context, store Store) (*Registry, error) {
+	s, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Providers == nil {
+		s.Providers = map[string]map[string]Record{}
+	}
+	return &Registry{store: store, state: s}, nil
+}
+
+// Records returns the records of the domains of provider managed by owner
+func (r *Registry) Records(provider, owner string) map[string]Record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	records := map[string]Record{}
+	for domain, record := range r.state.Providers[provider] {
+		if record.Owner == owner {
+			records[domain] = record
+		}
+	}
+	return records
+}
+
+// Set records the state of the records of domain, the state is persisted in the background
+func (r *Registry) Set(provider, domain string, record Record) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.state.Providers[provider] == nil {
+		r.state.Providers[provider] = map[string]Record{}
+	}
+	r.state.Providers[provider][domain] = record
+	r.changed()
+}
+
+// Delete forgets the records of domain, the state is persisted in the background
+func (r *Registry) Delete(provider, domain string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.state.Providers[provider][domain]; !ok {
+		return
+	}
+	delete(r.state.Providers[provider], domain)
+	if len(r.state.Providers[provider]) == 0 {
+		delete(r.state.Providers, provider)
+	}
+	r.changed()
+}
+
+// changed marks the state as changed and starts a writer unless one is running, r.lock must be held
+func (r *Registry) changed() {
+	r.dirty = true
+	if r.idle == nil {
+		r.idle = make(chan struct{})
+		go r.write(r.idle)
+	}
+}
+
+// write saves the state until it is persisted, the changes made during a save are coalesced in the next one.
+// After a failed save, the state is saved again on the next change or Flush
+func (r *Registry) write(idle chan struct{}) {
+	defer close(idle)
+	for {
+		r.lock.Lock()
+		if !r.dirty {
+			r.idle = nil
+			r.lock.Unlock()
+			return
+		}
+		r.dirty = false
+		s := State{Providers: map[string]map[string]Record{}}
+		for provider, records := range r.state.Providers {
+			s.Providers[provider] = map[string]Record{}
+			for domain, record := range records {
+				s.Providers[provider][domain] = record
+			}
+		}
+		r.lock.Unlock()
+
+		err := r.save(s)
+		r.lock.Lock()
+		r.err = err
+		if err != nil {
+			r.dirty = true
+			r.idle = nil
+			r.lock.Unlock()
+			if r.Logger != nil {
+				r.Logger.Error("failed to save the state", logger.Err(err))
+			}
+			return
+		}
+		r.lock.Unlock()
+	}
+}
+
+func (r *Registry) save(s State) error {
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	return r.store.Save(ctx, s)
+}
+
+// Flush persists the pending changes, and waits for them to be saved until ctx is done.
+// It returns the error of the last save
+func (r *Registry) Flush(ctx context.Context) error {
+	for {
+		r.lock.Lock()
+		if r.dirty && r.idle == nil {
+			r.changed()
+		}
+		idle := r.idle
+		r.lock.Unlock()
+		if idle == nil {
+			return nil
+		}
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r.lock.Lock()
+		err := r.err
+		r.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mohotani-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := &File{Path: filepath.Join(dir, "state.json")}
+
+	s, err := f.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, State{}, s)
+
+	updated := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	s = State{Providers: map[string]map[string]Record{
+		"gandi": {
+			"www.example.com":  {IPs: []string{"203.0.113.1"}, Owner: "mohotani", Updated: updated},
+			"www2.example.com": {Owner: "mohotani", Retry: &Retry{IPs: []string{"203.0.113.1"}, Attempt: 2, Error: "test error"}},
+		},
+	}}
+	assert.NoError(t, f.Save(context.Background(), s))
+	loaded, err := f.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, s, loaded)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files), "temporary files were left behind")
+
+	assert.NoError(t, ioutil.WriteFile(f.Path, []byte("not json"), 0600))
+	_, err = f.Load(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), f.Path)
+
+	f.Path = filepath.Join(dir, "missing", "state.json")
+	assert.Error(t, f.Save(context.Background(), s))
+}
+
+type testStore struct {
+	lock  sync.Mutex
+	state State
+	saves int
+	err   error
+	// block, when set, blocks saves until it is closed
+	block chan struct{}
+}
+
+func (s *testStore) Load(ctx context.Context) (State, error) {
+	return s.state, nil
+}
+
+func (s *testStore) Save(ctx context.Context, state State) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.saves++
+	if s.err != nil {
+		return s.err
+	}
+	s.state = state
+	return nil
+}
+
+func (s *testStore) get() (State, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.state, s.saves
+}
+
+func TestRegistry(t *testing.T) {
+	store := &testStore{}
+	r, err := Open(context.Background(), store)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Record{}, r.Records("gandi", "mohotani"))
+
+	r.Set("gandi", "www.example.com", Record{IPs: []string{"203.0.113.1"}, Owner: "mohotani"})
+	r.Set("gandi", "nas.example.com", Record{IPs: []string{"2001:db8::20"}, Owner: "nas.example.com"})
+	r.Set("route53", "www.example.org", Record{IPs: []string{"203.0.113.1"}, Owner: "mohotani"})
+	assert.Equal(t, map[string]Record{"www.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"}}, r.Records("gandi", "mohotani"))
+	assert.NoError(t, r.Flush(context.Background()))
+
+	r.Delete("route53", "www.example.org")
+	r.Delete("route53", "www.example.org")
+	assert.NoError(t, r.Flush(context.Background()))
+	s, _ := store.get()
+	assert.Equal(t, map[string]map[string]Record{
+		"gandi": {
+			"www.example.com": {IPs: []string{"203.0.113.1"}, Owner: "mohotani"},
+			"nas.example.com": {IPs: []string{"2001:db8::20"}, Owner: "nas.example.com"},
+		},
+	}, s.Providers)
+
+	r, err = Open(context.Background(), store)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Record{"nas.example.com": {IPs: []string{"2001:db8::20"}, Owner: "nas.example.com"}}, r.Records("gandi", "nas.example.com"))
+}
+
+func TestRegistryBackground(t *testing.T) {
+	store := &testStore{block: make(chan struct{})}
+	r, err := Open(context.Background(), store)
+	assert.NoError(t, err)
+
+	// changes do not wait for the store, and the changes made during a save are coalesced
+	for i := 0; i < 10; i++ {
+		r.Set("gandi", fmt.Sprintf("www%d.example.com", i), Record{IPs: []string{"203.0.113.1"}, Owner: "mohotani"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Flush(ctx))
+	close(store.block)
+	assert.NoError(t, r.Flush(context.Background()))
+	s, saves := store.get()
+	assert.Equal(t, 10, len(s.Providers["gandi"]))
+	assert.True(t, saves <= 2, "the changes were not coalesced")
+
+	// failed saves are returned by Flush, and saved again with the next change
+	store.lock.Lock()
+	store.err = fmt.Errorf("test error")
+	store.lock.Unlock()
+	r.Delete("gandi", "www0.example.com")
+	assert.EqualError(t, r.Flush(context.Background()), "test error")
+	store.lock.Lock()
+	store.err = nil
+	store.lock.Unlock()
+	r.Delete("gandi", "www1.example.com")
+	assert.NoError(t, r.Flush(context.Background()))
+	s, _ = store.get()
+	assert.Equal(t, 8, len(s.Providers["gandi"]))
+}